@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// benchRun is a single measured WalkDir of a benchmark.
+type benchRun struct {
+	Run     int     `json:"run"`
+	Count   int     `json:"count"`
+	Seconds float64 `json:"seconds"`
+	Errors  int     `json:"errors,omitempty"`
+}
+
+// benchReport is the result of repeatedly walking the same tree.
+type benchReport struct {
+	Warmup  int           `json:"warmup"`
+	Runs    []benchRun    `json:"runs"`
+	Seconds sampleSummary `json:"seconds"`
+	Count   sampleSummary `json:"count"`
+	// InconsistentRuns lists the runs whose count differs from the
+	// first run. Either the tree changed or the walk is not deterministic.
+	InconsistentRuns []int `json:"inconsistentRuns,omitempty"`
+}
+
+// benchmark runs WalkDir warmup times without measuring and then runs
+// times, and summarizes the measured runs.
+func benchmark(ctx context.Context, storage *xlStorage, opts WalkDirOptions, runs, warmup int, objectsOnly bool) (benchReport, error) {
+	rep := benchReport{Warmup: warmup}
+	for i := 0; i < warmup+runs; i++ {
+		start := time.Now()
+		res, err := storage.WalkDir(ctx, opts, func(metaCacheEntry) {})
+		took := time.Since(start)
+		if err != nil {
+			return rep, err
+		}
+		if i < warmup {
+			continue
+		}
+		count := res.Entries
+		if objectsOnly {
+			count = res.RealObjects()
+		}
+		rep.Runs = append(rep.Runs, benchRun{
+			Run:     len(rep.Runs) + 1,
+			Count:   count,
+			Seconds: took.Seconds(),
+			Errors:  len(res.Errors),
+		})
+	}
+
+	secs := make([]float64, len(rep.Runs))
+	counts := make([]float64, len(rep.Runs))
+	for i, r := range rep.Runs {
+		secs[i] = r.Seconds
+		counts[i] = float64(r.Count)
+		if r.Count != rep.Runs[0].Count {
+			rep.InconsistentRuns = append(rep.InconsistentRuns, r.Run)
+		}
+	}
+	rep.Seconds = summarize(secs)
+	rep.Count = summarize(counts)
+	return rep, nil
+}
+
+// runBench walks the same bucket repeatedly and reports statistics over
+// the duration and the number of entries of all runs.
+func runBench(args []string) error {
+	var opts WalkDirOptions
+	var sf storageFlags
+	fs := newFlagSet("bench", "<path/to/minio/bucket>")
+	addWalkDirFlags(fs, &opts)
+	sf.register(fs)
+	runs := fs.Int("runs", 10, "number of measured runs")
+	warmup := fs.Int("warmup", 1, "number of runs before the measured runs, to warm up caches")
+	objectsOnly := fs.Bool("objects-only", false, "only count real objects, like 'mc ls --recursive' does, and not prefixes")
+	format := fs.String("format", "text", "output format, text, csv or json")
+	diskPath, bucket, err := parseBucketArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	opts.Bucket = bucket
+	if *runs < 1 {
+		return fmt.Errorf("--runs must be at least 1, got %d", *runs)
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text, csv or json", *format)
+	}
+
+	storage, err := sf.newStorage(diskPath, bucket, nil)
+	if err != nil {
+		return err
+	}
+	defer sf.close()
+	rep, err := benchmark(context.TODO(), storage, opts, *runs, *warmup, *objectsOnly)
+	if err != nil {
+		return err
+	}
+	for _, run := range rep.InconsistentRuns {
+		fmt.Fprintf(os.Stderr, "%s: run %d listed %d entries, run 1 listed %d\n",
+			os.Args[0], run, rep.Runs[run-1].Count, rep.Runs[0].Count)
+	}
+	return printBenchReport(os.Stdout, *format, rep)
+}
+
+// printBenchReport prints a benchmark as a text summary, as one CSV line
+// per run in the format of the walk command, or as JSON.
+func printBenchReport(w io.Writer, format string, rep benchReport) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	case "csv":
+		for _, r := range rep.Runs {
+			if _, err := fmt.Fprintf(w, "%d;%f\n", r.Count, r.Seconds); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "text":
+		fmt.Fprintf(w, "runs:     %d (+%d warmup)\n", len(rep.Runs), rep.Warmup)
+		fmt.Fprintf(w, "duration: min %.6fs  median %.6fs  mean %.6fs  stddev %.6fs  p95 %.6fs\n",
+			rep.Seconds.Min, rep.Seconds.Median, rep.Seconds.Mean, rep.Seconds.Stddev, rep.Seconds.P95)
+		fmt.Fprintf(w, "count:    min %.0f  median %.0f  mean %.1f  stddev %.1f  p95 %.0f\n",
+			rep.Count.Min, rep.Count.Median, rep.Count.Mean, rep.Count.Stddev, rep.Count.P95)
+		if len(rep.InconsistentRuns) > 0 {
+			fmt.Fprintf(w, "WARNING:  %d runs listed a different number of entries than run 1: %v\n",
+				len(rep.InconsistentRuns), rep.InconsistentRuns)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected text, csv or json", format)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errRegression is returned by compare if the new results are
+// significantly slower than the old ones.
+var errRegression = errors.New("performance regression")
+
+// readResults reads walk results, either the ';' separated CSV of walk,
+// bench and sweep, or the JSON report of bench. Other JSON reports and
+// durations that are not positive are rejected, the comparison is done
+// on their logarithms.
+func readResults(name string) ([]point, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	first, err := r.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var pts []point
+	if strings.HasSuffix(name, ".json") || (len(first) == 1 && first[0] == '{') {
+		// Only the runs are needed. They are a pointer to tell a bench
+		// report apart from other JSON, like the report of walk.
+		var rep struct {
+			Runs *[]benchRun `json:"runs"`
+		}
+		if err := json.NewDecoder(r).Decode(&rep); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if rep.Runs == nil {
+			return nil, fmt.Errorf("%s: not a JSON report of bench, it has no runs", name)
+		}
+		for _, run := range *rep.Runs {
+			pts = append(pts, point{X: float64(run.Count), Y: run.Seconds})
+		}
+	} else if pts, err = readSeries(r); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(pts) == 0 {
+		return nil, fmt.Errorf("%s: no results", name)
+	}
+	for _, p := range pts {
+		if !(p.Y > 0) || math.IsInf(p.Y, 0) {
+			return nil, fmt.Errorf("%s: the run with %v entries took %v seconds, expected a positive, finite duration", name, p.X, p.Y)
+		}
+	}
+	return pts, nil
+}
+
+// groupByCount returns the durations of all runs per number of entries.
+func groupByCount(pts []point) map[float64][]float64 {
+	groups := make(map[float64][]float64)
+	for _, p := range pts {
+		groups[p.X] = append(groups[p.X], p.Y)
+	}
+	return groups
+}
+
+// comparePoint compares the runs of old and new with the same number of
+// entries.
+type comparePoint struct {
+	Count     float64 `json:"count"`
+	OldRuns   int     `json:"oldRuns"`
+	NewRuns   int     `json:"newRuns"`
+	OldMedian float64 `json:"oldMedian"`
+	NewMedian float64 `json:"newMedian"`
+	// Ratio is new/old of the geometric means, above 1 is a slowdown.
+	Ratio float64 `json:"ratio"`
+	// PValue of a Welch t-test on the logarithms of the durations. It is
+	// missing unless both sides have at least two runs.
+	PValue *float64 `json:"pValue,omitempty"`
+}
+
+// compareReport is the result of comparing two result files.
+type compareReport struct {
+	Old    string         `json:"old"`
+	New    string         `json:"new"`
+	Points []comparePoint `json:"points"`
+	// OnlyOld and OnlyNew count the entry counts present in one file only.
+	OnlyOld int `json:"onlyOld,omitempty"`
+	OnlyNew int `json:"onlyNew,omitempty"`
+	// Ratio is the geometric mean of the ratios of all points.
+	Ratio float64 `json:"ratio"`
+	// PValue tests whether Ratio differs from 1, see compareResults.
+	PValue     *float64 `json:"pValue,omitempty"`
+	Threshold  float64  `json:"threshold"`
+	Alpha      float64  `json:"alpha"`
+	Regression bool     `json:"regression"`
+}
+
+// logs returns the natural logarithms of values. Walk durations are
+// skewed to the right, their logarithms are closer to normal.
+func logs(values []float64) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = math.Log(v)
+	}
+	return res
+}
+
+// welchTest returns the two-sided p-value of Welch's t-test for equal
+// means of a and b, false if either has fewer than two values.
+func welchTest(a, b []float64) (float64, bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, false
+	}
+	va := stddev(a) * stddev(a) / float64(len(a))
+	vb := stddev(b) * stddev(b) / float64(len(b))
+	if va+vb == 0 {
+		if mean(a) == mean(b) {
+			return 1, true
+		}
+		return 0, true
+	}
+	t := (mean(a) - mean(b)) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(len(a)-1) + vb*vb/float64(len(b)-1))
+	return tTwoSided(t, df), true
+}
+
+// oneSampleTest returns the two-sided p-value of a t-test for mean zero
+// of values, false if there are fewer than two values.
+func oneSampleTest(values []float64) (float64, bool) {
+	if len(values) < 2 {
+		return 0, false
+	}
+	sd := stddev(values)
+	if sd == 0 {
+		if mean(values) == 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+	t := mean(values) / (sd / math.Sqrt(float64(len(values))))
+	return tTwoSided(t, float64(len(values)-1)), true
+}
+
+// compareResults lines up the runs of old and new by number of entries.
+// With several points, like two sweeps, the aggregate p-value tests the
+// log ratios of all points against zero. With a single point, like two
+// bench runs, it is the p-value of that point.
+func compareResults(oldPts, newPts []point) (compareReport, error) {
+	var rep compareReport
+	oldRuns, newRuns := groupByCount(oldPts), groupByCount(newPts)
+	for count, o := range oldRuns {
+		n, ok := newRuns[count]
+		if !ok {
+			rep.OnlyOld++
+			continue
+		}
+		lo, ln := logs(o), logs(n)
+		cp := comparePoint{
+			Count:     count,
+			OldRuns:   len(o),
+			NewRuns:   len(n),
+			OldMedian: summarize(o).Median,
+			NewMedian: summarize(n).Median,
+			Ratio:     math.Exp(mean(ln) - mean(lo)),
+		}
+		if p, ok := welchTest(lo, ln); ok {
+			cp.PValue = &p
+		}
+		rep.Points = append(rep.Points, cp)
+	}
+	for count := range newRuns {
+		if _, ok := oldRuns[count]; !ok {
+			rep.OnlyNew++
+		}
+	}
+	if len(rep.Points) == 0 {
+		return rep, errors.New("the files have no number of entries in common")
+	}
+	sort.Slice(rep.Points, func(i, j int) bool { return rep.Points[i].Count < rep.Points[j].Count })
+
+	logRatios := make([]float64, len(rep.Points))
+	for i, cp := range rep.Points {
+		logRatios[i] = math.Log(cp.Ratio)
+	}
+	rep.Ratio = math.Exp(mean(logRatios))
+	if len(rep.Points) == 1 {
+		rep.PValue = rep.Points[0].PValue
+	} else if p, ok := oneSampleTest(logRatios); ok {
+		rep.PValue = &p
+	}
+	return rep, nil
+}
+
+// runCompare compares two result files and fails if the new results are
+// slower than the old ones by more than the threshold, significantly.
+func runCompare(args []string) error {
+	fs := newFlagSet("compare", "<old.csv|old.json> <new.csv|new.json>")
+	threshold := fs.Float64("threshold", 0.05, "slowdown that counts as regression, 0.05 is 5% slower")
+	alpha := fs.Float64("alpha", 0.05, "significance level, a slowdown is only a regression if its p-value is below")
+	format := fs.String("format", "text", "output format, text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("compare: expected two result files, got %d arguments", fs.NArg())
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+
+	oldPts, err := readResults(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newPts, err := readResults(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	rep, err := compareResults(oldPts, newPts)
+	if err != nil {
+		return fmt.Errorf("%s and %s: %w", fs.Arg(0), fs.Arg(1), err)
+	}
+	rep.Old, rep.New = fs.Arg(0), fs.Arg(1)
+	rep.Threshold, rep.Alpha = *threshold, *alpha
+	// Without a p-value, e.g. one run on each side, the threshold alone
+	// decides.
+	rep.Regression = rep.Ratio > 1+*threshold && (rep.PValue == nil || *rep.PValue < *alpha)
+
+	if err := printCompareReport(os.Stdout, *format, rep); err != nil {
+		return err
+	}
+	if rep.Regression {
+		return fmt.Errorf("%w: %s is %.1f%% slower than %s", errRegression, rep.New, (rep.Ratio-1)*100, rep.Old)
+	}
+	return nil
+}
+
+// formatPValue prints a p-value, or '-' if there is none.
+func formatPValue(p *float64) string {
+	if p == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3g", *p)
+}
+
+// formatChange prints a ratio as change in percent, e.g. +12.5% for a
+// ratio of 1.125.
+func formatChange(ratio float64) string {
+	return fmt.Sprintf("%+.1f%%", (ratio-1)*100)
+}
+
+func printCompareReport(w io.Writer, format string, rep compareReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Fprintf(w, "%10s %6s %6s %12s %12s %9s %9s\n", "count", "old n", "new n", "old median", "new median", "change", "p")
+	for _, cp := range rep.Points {
+		fmt.Fprintf(w, "%10g %6d %6d %11.6fs %11.6fs %9s %9s\n", cp.Count, cp.OldRuns, cp.NewRuns,
+			cp.OldMedian, cp.NewMedian, formatChange(cp.Ratio), formatPValue(cp.PValue))
+	}
+	if rep.OnlyOld > 0 || rep.OnlyNew > 0 {
+		fmt.Fprintf(w, "skipped %d counts only in %s, %d only in %s\n", rep.OnlyOld, rep.Old, rep.OnlyNew, rep.New)
+	}
+	verdict := "no regression"
+	switch {
+	case rep.Regression:
+		verdict = "REGRESSION"
+	case rep.Ratio < 1 && (rep.PValue == nil || *rep.PValue < rep.Alpha):
+		verdict = "faster"
+	}
+	_, err := fmt.Fprintf(w, "geomean:   %s (%.4fx), p %s, threshold +%.1f%%: %s\n",
+		formatChange(rep.Ratio), rep.Ratio, formatPValue(rep.PValue), rep.Threshold*100, verdict)
+	return err
+}
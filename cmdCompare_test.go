@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWelchTest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		p    float64
+		ok   bool
+	}{
+		// t = -3/sqrt(2) with 2 degrees of freedom, P(|T| > t) is
+		// 1 - t/sqrt(t^2 + 2).
+		{"different means", []float64{1, 3}, []float64{4, 6}, 1 - math.Sqrt(4.5/6.5), true},
+		{"same values", []float64{2, 2}, []float64{2, 2}, 1, true},
+		{"different constants", []float64{2, 2}, []float64{3, 3}, 0, true},
+		{"single run", []float64{1}, []float64{4, 6}, 0, false},
+	}
+	for _, tc := range tests {
+		p, ok := welchTest(tc.a, tc.b)
+		if ok != tc.ok || math.Abs(p-tc.p) > 1e-12 {
+			t.Errorf("%s: got p %g, %v, want %g, %v", tc.name, p, ok, tc.p, tc.ok)
+		}
+	}
+}
+
+func TestOneSampleTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		ok     bool
+	}{
+		// t = 2*sqrt(3) with 2 degrees of freedom.
+		{"mean 2", []float64{1, 2, 3}, 1 - math.Sqrt(12.0/14), true},
+		{"symmetric", []float64{-1, 1}, 1, true},
+		{"all zero", []float64{0, 0, 0}, 1, true},
+		{"constant", []float64{0.1, 0.1}, 0, true},
+		{"single value", []float64{0.1}, 0, false},
+	}
+	for _, tc := range tests {
+		p, ok := oneSampleTest(tc.values)
+		if ok != tc.ok || math.Abs(p-tc.p) > 1e-12 {
+			t.Errorf("%s: got p %g, %v, want %g, %v", tc.name, p, ok, tc.p, tc.ok)
+		}
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	old := []point{{10, 1}, {10, 2}, {20, 2}, {20, 4}, {30, 3}}
+	var doubled []point
+	for _, p := range old {
+		doubled = append(doubled, point{X: p.X, Y: 2 * p.Y})
+	}
+	doubled = append(doubled, point{40, 1})
+
+	rep, err := compareResults(old, doubled)
+	if err != nil {
+		t.Fatalf("compareResults: %v", err)
+	}
+	if len(rep.Points) != 3 || rep.OnlyOld != 0 || rep.OnlyNew != 1 {
+		t.Fatalf("got %d points, %d only old, %d only new, want 3, 0, 1", len(rep.Points), rep.OnlyOld, rep.OnlyNew)
+	}
+	for i, cp := range rep.Points {
+		if cp.Count != float64(10*(i+1)) || math.Abs(cp.Ratio-2) > 1e-12 {
+			t.Errorf("point %d: count %g, ratio %g, want %d, 2", i, cp.Count, cp.Ratio, 10*(i+1))
+		}
+	}
+	// The log ratios of the points are all the same.
+	if math.Abs(rep.Ratio-2) > 1e-12 || rep.PValue == nil || *rep.PValue > 1e-12 {
+		t.Errorf("got ratio %g, p-value %s, want 2, 0", rep.Ratio, formatPValue(rep.PValue))
+	}
+	if p := rep.Points[2].PValue; p != nil {
+		t.Errorf("point with a single run on each side has p-value %g", *p)
+	}
+	// The logarithms 0, ln 2 and ln 2, ln 4 give t = -sqrt(2) with 2
+	// degrees of freedom.
+	if p := rep.Points[0].PValue; p == nil || math.Abs(*p-(1-math.Sqrt(0.5))) > 1e-12 {
+		t.Errorf("first point has p-value %s, want %g", formatPValue(p), 1-math.Sqrt(0.5))
+	}
+
+	if _, err := compareResults(old, []point{{50, 1}}); err == nil {
+		t.Errorf("compared results without counts in common")
+	}
+}
+
+func TestRunCompare(t *testing.T) {
+	dir := t.TempDir()
+	// write writes a result file with the given number of runs per
+	// count, each run taking factor times the baseline, give or take 1%.
+	write := func(name string, factor float64, runs int, counts ...int) string {
+		var b strings.Builder
+		for _, count := range counts {
+			for i := 0; i < runs; i++ {
+				fmt.Fprintf(&b, "%d;%f\n", count, factor*float64(count)*1e-4*(1+0.01*float64(i-1)))
+			}
+		}
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, []byte(b.String()), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	sweep := []int{1000, 2000, 4000}
+	old := write("old.csv", 1, 3, sweep...)
+	single := write("single.csv", 1, 1, 1000)
+
+	// The report goes to stdout.
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	tests := []struct {
+		name       string
+		old, new   string
+		regression bool
+	}{
+		{"same", old, write("same.csv", 1, 3, sweep...), false},
+		{"faster", old, write("faster.csv", 0.5, 3, sweep...), false},
+		{"slower within threshold", old, write("slightly.csv", 1.03, 3, sweep...), false},
+		{"slower", old, write("slower.csv", 1.5, 3, sweep...), true},
+		// Without a p-value the threshold alone decides.
+		{"slower single run", single, write("slower-single.csv", 1.5, 1, 1000), true},
+		{"single run within threshold", single, write("slightly-single.csv", 1.03, 1, 1000), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runCompare([]string{tc.old, tc.new})
+			if tc.regression && !errors.Is(err, errRegression) {
+				t.Errorf("got error %v, want %v", err, errRegression)
+			}
+			if !tc.regression && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// faultCheckReport compares a walk with injected faults to a walk of the
+// same tree without faults.
+type faultCheckReport struct {
+	Faults       map[string]int `json:"faults"`
+	CleanEntries int            `json:"cleanEntries"`
+	Entries      int            `json:"entries"`
+	Errors       int            `json:"errors"`
+	// MissingReported entries are missing, but an error was reported for
+	// them or one of their parents.
+	MissingReported int `json:"missingReported"`
+	// MissingChanged entries are missing because a fault simulated that
+	// they, or one of their parents, vanished.
+	MissingChanged int `json:"missingChanged"`
+	// Unreported entries are missing without any reported error.
+	Unreported []string `json:"unreported,omitempty"`
+	// Additional entries were not listed by the walk without faults, but
+	// an error was reported for them or a fault changed the tree there.
+	// E.g. an object whose metadata cannot be read is listed as prefix.
+	Additional int `json:"additional"`
+	// Unexpected entries were not listed by the walk without faults, and
+	// cannot be explained by a reported error or a change of the tree.
+	Unexpected []string `json:"unexpected,omitempty"`
+	// Swallowed are I/O faults, not changes of the tree, for which no
+	// error was reported. They did not necessarily change the result.
+	Swallowed []string `json:"swallowed,omitempty"`
+	OK        bool     `json:"ok"`
+}
+
+// faultBase returns the object or directory a failed path belongs to,
+// e.g. a/b for a/b/xl.meta and a/b for a/b__XLDIR__/xl.meta or a/b/.
+func faultBase(p string) string {
+	p = strings.TrimSuffix(p, SlashSeparator)
+	if strings.HasSuffix(p, SlashSeparator+xlStorageFormatFile) || strings.HasSuffix(p, SlashSeparator+xlStorageFormatFileV1) ||
+		p == xlStorageFormatFile || p == xlStorageFormatFileV1 {
+		p = pathDir(p)
+	}
+	return strings.TrimSuffix(p, globalDirSuffix)
+}
+
+// pathDir returns everything before the last slash of p, or "" if there
+// is none.
+func pathDir(p string) string {
+	if i := strings.LastIndex(p, SlashSeparator); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+// affects returns if a fault at base can change the entry name: the
+// entry itself or anything below it.
+func affects(base, name string) bool {
+	if base == "" {
+		return true
+	}
+	name = strings.TrimSuffix(name, SlashSeparator)
+	return name == base || strings.HasPrefix(name, base+SlashSeparator)
+}
+
+func affectedByAny(bases []string, name string) bool {
+	for _, b := range bases {
+		if affects(b, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFaults explains the difference between the entries of a walk
+// without faults and a walk with faults. Every missing entry must be
+// covered by a reported error or by a fault that simulated a change of
+// the tree, and so must every additional entry.
+func checkFaults(clean, faulty []string, res walkResult, faults []injectedFault) faultCheckReport {
+	rep := faultCheckReport{
+		Faults:       faultCounts(faults),
+		CleanEntries: len(clean),
+		Entries:      len(faulty),
+		Errors:       len(res.Errors),
+	}
+	var errBases, changeBases []string
+	for _, e := range res.Errors {
+		errBases = append(errBases, faultBase(e.Path))
+	}
+	for _, f := range faults {
+		if f.Kind.changesLayout() {
+			changeBases = append(changeBases, faultBase(f.Path))
+			continue
+		}
+		// Errors are reported relative to the bucket as well.
+		if !affectedByAny(errBases, faultBase(f.Path)) {
+			rep.Swallowed = append(rep.Swallowed, fmt.Sprintf("%s %s %s", f.Kind, f.Op, f.Path))
+		}
+	}
+
+	listed := make(map[string]bool, len(faulty))
+	for _, name := range faulty {
+		listed[name] = true
+	}
+	known := make(map[string]bool, len(clean))
+	for _, name := range clean {
+		known[name] = true
+		if listed[name] {
+			continue
+		}
+		switch {
+		case affectedByAny(errBases, name):
+			rep.MissingReported++
+		case affectedByAny(changeBases, name):
+			rep.MissingChanged++
+		default:
+			rep.Unreported = append(rep.Unreported, name)
+		}
+	}
+	for _, name := range faulty {
+		switch {
+		case known[name]:
+		case affectedByAny(errBases, name), affectedByAny(changeBases, name):
+			rep.Additional++
+		default:
+			rep.Unexpected = append(rep.Unexpected, name)
+		}
+	}
+	rep.OK = len(rep.Unreported) == 0 && len(rep.Unexpected) == 0
+	return rep
+}
+
+// reportWalkError records the error that failed a walk as a whole, e.g.
+// a fault on checking the bucket, as an error of the whole bucket. Every
+// missing entry is reported then.
+func reportWalkError(res walkResult, err error) walkResult {
+	if err != nil {
+		res.Errors = append(res.Errors, walkError{Op: "WalkDir", Err: err})
+	}
+	return res
+}
+
+// runFaultCheck walks a bucket without and with injected faults and
+// checks that every difference is accounted for. It fails if entries
+// went missing without a reported error or showed up unexpectedly.
+func runFaultCheck(args []string) error {
+	var opts WalkDirOptions
+	var sf storageFlags
+	fs := newFlagSet("fault-check", "<path/to/minio/bucket>")
+	addWalkDirFlags(fs, &opts)
+	sf.register(fs)
+	format := fs.String("format", "text", "output format, text or json")
+	diskPath, bucket, err := parseBucketArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	opts.Bucket = bucket
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+	if sf.faults == "" {
+		return fmt.Errorf("nothing to check, configure the faults to inject with --faults")
+	}
+
+	walk := func(storage *xlStorage) ([]string, walkResult, error) {
+		var names []string
+		res, err := storage.WalkDir(context.TODO(), opts, func(e metaCacheEntry) {
+			names = append(names, e.name)
+		})
+		return names, res, err
+	}
+	// Only trace the walk with faults.
+	cleanFlags := sf
+	cleanFlags.faults = ""
+	cleanFlags.tracePath = ""
+	cleanFlags.chromePath = ""
+	defer sf.close()
+	cleanStorage, err := cleanFlags.newStorage(diskPath, bucket, nil)
+	if err != nil {
+		return err
+	}
+	clean, cleanRes, err := walk(cleanStorage)
+	if err != nil {
+		return fmt.Errorf("walk without faults: %w", err)
+	}
+	if len(cleanRes.Errors) > 0 {
+		printWalkErrors(cleanRes.Errors)
+		return fmt.Errorf("walk without faults reported %d errors, fix them first", len(cleanRes.Errors))
+	}
+	storage, err := sf.newStorage(diskPath, bucket, nil)
+	if err != nil {
+		return err
+	}
+	faulty, res, err := walk(storage)
+	res = reportWalkError(res, err)
+
+	rep := checkFaults(clean, faulty, res, sf.injector.faults())
+	if err := printFaultCheckReport(os.Stdout, *format, rep); err != nil {
+		return err
+	}
+	if !rep.OK {
+		return fmt.Errorf("%d entries missing without error, %d unexpected entries", len(rep.Unreported), len(rep.Unexpected))
+	}
+	return nil
+}
+
+func printFaultCheckReport(w io.Writer, format string, rep faultCheckReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Fprintf(w, "faults:     %s\n", formatFaultCounts(rep.Faults))
+	fmt.Fprintf(w, "entries:    %d without faults, %d with faults, %d errors reported\n", rep.CleanEntries, rep.Entries, rep.Errors)
+	fmt.Fprintf(w, "missing:    %d with a reported error, %d vanished\n", rep.MissingReported, rep.MissingChanged)
+	fmt.Fprintf(w, "additional: %d with a reported error or next to a vanished entry\n", rep.Additional)
+	for _, name := range rep.Unreported {
+		fmt.Fprintf(w, "UNREPORTED: %s\n", name)
+	}
+	for _, name := range rep.Unexpected {
+		fmt.Fprintf(w, "UNEXPECTED: %s\n", name)
+	}
+	for _, f := range rep.Swallowed {
+		fmt.Fprintf(w, "swallowed:  %s\n", f)
+	}
+	verdict := "OK"
+	if !rep.OK {
+		verdict = "FAILED"
+	}
+	_, err := fmt.Fprintf(w, "result:     %s\n", verdict)
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// runGen creates a synthetic MinIO bucket on disk and prints what it
+// created as JSON.
+func runGen(args []string) error {
+	var cfg genConfig
+	fs := newFlagSet("gen", "<path/to/bucket>")
+	fs.IntVar(&cfg.Depth, "depth", 2, "number of directory levels below the bucket")
+	fs.IntVar(&cfg.Fanout, "fanout", 10, "number of sub directories per directory")
+	fs.IntVar(&cfg.FilesPerDir, "files-per-dir", 100, "number of objects per directory")
+	fs.Float64Var(&cfg.DirObjectRatio, "dir-objects", 0, "share of objects stored as directory objects (__XLDIR__), 0 to 1")
+	fs.Float64Var(&cfg.LegacyRatio, "legacy", 0, "share of objects stored as legacy xl.json, 0 to 1")
+	fs.IntVar(&cfg.EmptyDirs, "empty-dirs", 0, "number of empty leftover directories per directory")
+	fs.IntVar(&cfg.StrayFiles, "stray-files", 0, "number of files per directory that are neither xl.meta nor xl.json")
+	fs.IntVar(&cfg.Versions, "versions", 1, "number of versions per object, more than one enables versioning")
+	fs.Float64Var(&cfg.DeleteMarkerRatio, "delete-markers", 0, "share of objects whose latest version is a delete marker, 0 to 1, enables versioning")
+	fs.Int64Var(&cfg.Seed, "seed", 1, "seed of the random generator, the same seed generates the same tree")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("gen: expected exactly one path to a bucket, got %d arguments", fs.NArg())
+	}
+	if cfg.DirObjectRatio < 0 || cfg.LegacyRatio < 0 || cfg.DirObjectRatio+cfg.LegacyRatio > 1 {
+		return fmt.Errorf("--dir-objects and --legacy must be between 0 and 1 and add up to at most 1")
+	}
+	if cfg.Versions < 1 {
+		return fmt.Errorf("--versions must be at least 1, got %d", cfg.Versions)
+	}
+	if cfg.DeleteMarkerRatio < 0 || cfg.DeleteMarkerRatio > 1 {
+		return fmt.Errorf("--delete-markers must be between 0 and 1")
+	}
+
+	res, err := generateBucket(osGenFS{}, fs.Arg(0), cfg)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// plotReport is the result of the analysis of a sweep.
+type plotReport struct {
+	File   string    `json:"file"`
+	Chart  string    `json:"chart"`
+	Points int       `json:"points"`
+	From   float64   `json:"from"`
+	To     float64   `json:"to"`
+	Linear linearFit `json:"linear"`
+	// Models are fit to all points, Best is the model with the highest
+	// adjusted R².
+	Models []modelFit `json:"models"`
+	Best   string     `json:"best,omitempty"`
+	Kink   *kinkFit   `json:"kink,omitempty"`
+}
+
+// runPlot replaces plot.plt: it fits a straight line through the walk
+// results of a sweep and renders the results and the fit as SVG chart.
+// It also fits the scaling models to all results and searches the point
+// where the duration departs from the linear trend.
+func runPlot(args []string) error {
+	fs := newFlagSet("plot", "<results.csv>")
+	from := fs.Float64("from", 0, "smallest number of entries included in the fit")
+	to := fs.Float64("to", 15000, "largest number of entries included in the fit")
+	out := fs.String("out", "", "path of the SVG chart, defaults to the CSV file with the extension .svg")
+	title := fs.String("title", "", "title of the chart")
+	format := fs.String("format", "text", "output format of the fit, text or json")
+	alpha := fs.Float64("alpha", 0.01, "significance level of the kink detection and of models with more coefficients than the linear one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("plot: expected exactly one CSV file, got %d arguments", fs.NArg())
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+	if *from > *to {
+		return fmt.Errorf("--from %g is larger than --to %g", *from, *to)
+	}
+
+	file := fs.Arg(0)
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	pts, err := readSeries(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	fit, err := fitLinear(inRange(pts, *from, *to))
+	if err != nil {
+		return fmt.Errorf("%s: range %g-%g: %w", file, *from, *to, err)
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(file, ".csv") + ".svg"
+	}
+
+	// Draw the fit line over the whole range of the data, like gnuplot
+	// draws f(x).
+	minX, maxX := pts[0].X, pts[0].X
+	for _, p := range pts {
+		if p.X < minX {
+			minX = p.X
+		}
+		if p.X > maxX {
+			maxX = p.X
+		}
+	}
+	rep := plotReport{File: file, Chart: *out, Points: len(pts), From: *from, To: *to, Linear: fit}
+	rep.Models = fitModels(pts)
+	if i := bestModel(pts, rep.Models, *alpha); i >= 0 {
+		rep.Best = rep.Models[i].Model
+	}
+	if kink, ok := detectKink(pts, *alpha); ok {
+		rep.Kink = &kink
+	}
+
+	c := chart{
+		Title:  *title,
+		XLabel: "Num. files",
+		YLabel: "Time / s",
+		Series: []chartSeries{
+			{Name: file, Points: pts, Markers: true},
+			{
+				Name:   fmt.Sprintf("Linear regression (range %g-%g)", *from, *to),
+				Points: []point{{minX, fit.at(minX)}, {maxX, fit.at(maxX)}},
+				Dashed: true,
+			},
+		},
+	}
+	if rep.Kink != nil && rep.Kink.Significant {
+		c.Series = append(c.Series, chartSeries{
+			Name:   fmt.Sprintf("Kink at %g entries", rep.Kink.Count),
+			Points: []point{{minX, rep.Kink.at(minX)}, {rep.Kink.Count, rep.Kink.at(rep.Kink.Count)}, {maxX, rep.Kink.at(maxX)}},
+			Dashed: true,
+		})
+	}
+	svg, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := c.writeSVG(svg); err != nil {
+		svg.Close()
+		return err
+	}
+	if err := svg.Close(); err != nil {
+		return err
+	}
+
+	return printPlotReport(os.Stdout, *format, rep)
+}
+
+func printPlotReport(w io.Writer, format string, rep plotReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Fprintf(w, "chart:     %s (%d points)\n", rep.Chart, rep.Points)
+	fmt.Fprintf(w, "linear:    f(x) = m * x + q over %g-%g (%d points)\n", rep.From, rep.To, rep.Linear.N)
+	fmt.Fprintf(w, "m:         %g s/entry\n", rep.Linear.Slope)
+	fmt.Fprintf(w, "q:         %g s\n", rep.Linear.Intercept)
+	fmt.Fprintf(w, "R²:        %.6f\n", rep.Linear.R2)
+
+	fmt.Fprintf(w, "\nmodels over all %d points:\n", rep.Points)
+	for _, m := range rep.Models {
+		best := ""
+		if m.Model == rep.Best {
+			best = "  <- best"
+		}
+		fmt.Fprintf(w, "%-10s %-16s R² %.6f  adj. R² %.6f  RMSE %.6fs  %v%s\n",
+			m.Model, m.Formula, m.R2, m.AdjustedR2, m.RMSE, m.Coefficients, best)
+	}
+
+	if k := rep.Kink; k != nil {
+		verdict := "not significant"
+		if k.Significant {
+			verdict = "significant"
+		}
+		fmt.Fprintf(w, "\nkink:      at %g entries, slope %g s/entry before, %g s/entry after (%.1fx)\n",
+			k.Count, k.SlopeBefore, k.SlopeAfter, k.SlopeAfter/k.SlopeBefore)
+		fmt.Fprintf(w, "           F %.2f, p %.3g, %s\n", k.F, k.PValue, verdict)
+	}
+	return nil
+}
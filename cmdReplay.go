@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// readTrace reads the events of a trace, sorted by start time.
+func readTrace(name string) ([]traceEvent, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []traceEvent
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var ev traceEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", name, len(events)+1, err)
+		}
+		events = append(events, ev)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].T < events[j].T })
+	return events, nil
+}
+
+// replayOpStats compares the recorded and replayed calls of an operation.
+type replayOpStats struct {
+	Op     string `json:"op"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors"`
+	// Mismatches are calls whose errno or size differ from the trace.
+	Mismatches int `json:"mismatches"`
+	// Skipped are calls on files that could not be opened in the replay.
+	Skipped         int     `json:"skipped,omitempty"`
+	RecordedSeconds float64 `json:"recordedSeconds"`
+	ReplayedSeconds float64 `json:"replayedSeconds"`
+}
+
+// replayReport is the result of replaying a trace.
+type replayReport struct {
+	Trace string          `json:"trace"`
+	Root  string          `json:"root"`
+	Ops   []replayOpStats `json:"ops"`
+	// Seconds is the wall time of the trace and of the replay.
+	RecordedSeconds float64 `json:"recordedSeconds"`
+	ReplayedSeconds float64 `json:"replayedSeconds"`
+}
+
+// replayFile is a file opened during a replay. last is closed once the
+// last call issued on the file returned, calls on a file are issued in
+// the recorded order.
+type replayFile struct {
+	last chan struct{}
+	f    walkFile
+}
+
+// replayer issues the calls of a trace against a filesystem.
+type replayer struct {
+	fs   walkFS
+	root string
+
+	mu    sync.Mutex
+	files map[int64]*replayFile
+	ops   map[string]*replayOpStats
+}
+
+// prepare queues a call on a file behind the previous call on the same
+// file, before the call is issued. The call must wait for prev and close
+// done when it returned. Both are nil for calls not on a file.
+func (r *replayer) prepare(ev traceEvent) (rf *replayFile, prev, done chan struct{}) {
+	if ev.FD == 0 {
+		return nil, nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rf = r.files[ev.FD]
+	if rf == nil {
+		rf = &replayFile{}
+		r.files[ev.FD] = rf
+	}
+	prev, done = rf.last, make(chan struct{})
+	rf.last = done
+	return rf, prev, done
+}
+
+// issue replays a single call and records how it went. Calls on a file
+// run after the previous call on it, see prepare.
+func (r *replayer) issue(ev traceEvent, rf *replayFile, prev, done chan struct{}) {
+	if prev != nil {
+		<-prev
+	}
+	if done != nil {
+		defer close(done)
+	}
+	name := pathJoin(r.root, ev.Path)
+	var size int64
+	var err error
+	// Calls on a file that could not be opened are skipped.
+	skipped := ev.Op != "open" && rf != nil && rf.f == nil
+
+	start := time.Now()
+	switch {
+	case skipped:
+	case ev.Op == "readdir":
+		var entries []string
+		entries, err = r.fs.ReadDir(name, ev.Count)
+		size = int64(len(entries))
+	case ev.Op == "open":
+		var f walkFile
+		f, err = r.fs.Open(name)
+		if rf != nil {
+			rf.f = f
+		} else if err == nil {
+			// The open failed when it was recorded.
+			f.Close()
+		}
+	case ev.Op == "read":
+		var n int
+		n, err = rf.f.Read(make([]byte, ev.Len))
+		size = int64(n)
+	case ev.Op == "stat":
+		var fi os.FileInfo
+		if fi, err = rf.f.Stat(); err == nil {
+			size = fi.Size()
+		}
+	case ev.Op == "close":
+		err = rf.f.Close()
+	case ev.Op == "readfile":
+		var data []byte
+		data, err = r.fs.ReadFile(name)
+		size = int64(len(data))
+	case ev.Op == "lstat":
+		var fi os.FileInfo
+		if fi, err = r.fs.Lstat(name); err == nil {
+			size = fi.Size()
+		}
+	case ev.Op == "access":
+		err = r.fs.Access(name)
+	default:
+		skipped = true
+	}
+	took := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.ops[ev.Op]
+	if st == nil {
+		st = &replayOpStats{Op: ev.Op}
+		r.ops[ev.Op] = st
+	}
+	st.Calls++
+	st.RecordedSeconds += time.Duration(ev.Dur).Seconds()
+	if skipped {
+		st.Skipped++
+		return
+	}
+	st.ReplayedSeconds += took.Seconds()
+	if err != nil && err != io.EOF {
+		st.Errors++
+	}
+	// Sizes of opens, closes and accesses are not recorded, sizes of
+	// failed calls are meaningless.
+	sizeDiffers := err == nil && ev.Op != "open" && ev.Op != "access" && ev.Op != "close" && size != ev.Size
+	failedDiffers := (err != nil) != (ev.Err != "")
+	if errnoName(err) != ev.Errno || failedDiffers || sizeDiffers {
+		st.Mismatches++
+	}
+}
+
+// replay issues all events of a trace against fs below root. With
+// timing every call is issued at its recorded offset, concurrently if
+// the recorded calls overlapped. Otherwise the calls are issued one
+// after another.
+func replay(fs walkFS, root string, events []traceEvent, timing bool) replayReport {
+	r := &replayer{fs: fs, root: root, files: make(map[int64]*replayFile), ops: make(map[string]*replayOpStats)}
+	rep := replayReport{Root: root}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, ev := range events {
+		rf, prev, done := r.prepare(ev)
+		if !timing {
+			r.issue(ev, rf, prev, done)
+			continue
+		}
+		time.Sleep(time.Until(start.Add(time.Duration(ev.T))))
+		wg.Add(1)
+		go func(ev traceEvent) {
+			defer wg.Done()
+			r.issue(ev, rf, prev, done)
+		}(ev)
+	}
+	wg.Wait()
+	rep.ReplayedSeconds = time.Since(start).Seconds()
+
+	if n := len(events); n > 0 {
+		rep.RecordedSeconds = time.Duration(events[n-1].T + events[n-1].Dur).Seconds()
+	}
+	for _, st := range r.ops {
+		rep.Ops = append(rep.Ops, *st)
+	}
+	sort.Slice(rep.Ops, func(i, j int) bool { return rep.Ops[i].Op < rep.Ops[j].Op })
+	return rep
+}
+
+// runReplay re-issues the filesystem calls of a trace recorded with
+// --trace against another disk path and compares the durations.
+func runReplay(args []string) error {
+	fs := newFlagSet("replay", "<trace.jsonl> <path/to/disk>")
+	timing := fs.Bool("timing", false, "issue every call at its recorded time, concurrently like recorded, instead of one after another")
+	format := fs.String("format", "text", "output format, text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("replay: expected a trace and a disk path, got %d arguments", fs.NArg())
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+
+	events, err := readTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	rep := replay(osFS{}, fs.Arg(1), events, *timing)
+	rep.Trace = fs.Arg(0)
+	return printReplayReport(os.Stdout, *format, rep)
+}
+
+func printReplayReport(w io.Writer, format string, rep replayReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Fprintf(w, "%-9s %8s %7s %10s %8s %12s %12s\n", "op", "calls", "errors", "mismatches", "skipped", "recorded", "replayed")
+	for _, st := range rep.Ops {
+		fmt.Fprintf(w, "%-9s %8d %7d %10d %8d %11.6fs %11.6fs\n", st.Op, st.Calls, st.Errors, st.Mismatches,
+			st.Skipped, st.RecordedSeconds, st.ReplayedSeconds)
+	}
+	_, err := fmt.Fprintf(w, "wall time: %fs recorded, %fs replayed against %s\n", rep.RecordedSeconds, rep.ReplayedSeconds, rep.Root)
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (u [16]byte, err error) {
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return u, nil
+}
+
+// writeXLMeta writes an xl.meta file the way MinIO does, with O_DSYNC,
+// creating all parent directories.
+func writeXLMeta(filePath string, buf []byte) error {
+	if err := os.MkdirAll(path.Dir(filePath), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|writeMode, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// putObject stores an object below bucketDir like 'mc cp' does against a
+// single drive MinIO: a small object ends up inline in its xl.meta.
+func putObject(bucketDir, object string, data []byte) error {
+	dataDir, err := newUUID()
+	if err != nil {
+		return err
+	}
+	buf := newInlineObject(data, time.Now(), dataDir)
+	return writeXLMeta(pathJoin(bucketDir, object, xlStorageFormatFile), buf)
+}
+
+// sweepConfig describes how a sweep grows the tree: folders named
+// MinFolders to MaxFolders, holding FilesPerFolder objects each.
+type sweepConfig struct {
+	MinFolders     int
+	MaxFolders     int
+	FilesPerFolder int
+}
+
+// sweep grows the tree below the bucket folder by folder and walks the
+// bucket after every folder. The duration of every PUT is passed to put
+// and the result of every walk to open.
+func sweep(ctx context.Context, storage *xlStorage, opts WalkDirOptions, cfg sweepConfig,
+	put func(time.Duration) error, open func(walkResult, time.Duration) error) error {
+	bucketDir := pathJoin(storage.diskPath, opts.Bucket)
+	if err := os.MkdirAll(bucketDir, 0777); err != nil {
+		return err
+	}
+	for i := cfg.MinFolders; i <= cfg.MaxFolders; i++ {
+		for j := 1; j <= cfg.FilesPerFolder; j++ {
+			if contextCanceled(ctx) {
+				return ctx.Err()
+			}
+			start := time.Now()
+			if err := putObject(bucketDir, fmt.Sprintf("%d/file%d", i, j), nil); err != nil {
+				return err
+			}
+			if err := put(time.Since(start)); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		res, err := storage.WalkDir(ctx, opts, func(metaCacheEntry) {})
+		took := time.Since(start)
+		printWalkErrors(res.Errors)
+		if err != nil {
+			return err
+		}
+		if err := open(res, took); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSweep replaces measure-openFileNolog.sh. It writes the same two CSV
+// files, <prefix>.PUT.<min>.<max>.<files>.csv with the duration of every
+// PUT and <prefix>.OPEN.<min>.<max>.<files>.csv with the number of
+// entries and the duration of one walk per folder, but writes the
+// objects directly instead of going through a MinIO server. A PUT is
+// therefore only the local O_DSYNC write of an xl.meta and much faster
+// than the 'mc cp' the script times.
+func runSweep(args []string) error {
+	var opts WalkDirOptions
+	var sf storageFlags
+	var cfg sweepConfig
+	fs := newFlagSet("sweep", "<path/to/bucket>")
+	addWalkDirFlags(fs, &opts)
+	sf.register(fs)
+	fs.IntVar(&cfg.MinFolders, "min-folders", 1, "name of the first folder to create")
+	fs.IntVar(&cfg.MaxFolders, "max-folders", 400, "name of the last folder to create")
+	fs.IntVar(&cfg.FilesPerFolder, "files-per-folder", 50, "number of objects to create in every folder")
+	prefix := fs.String("out-prefix", "", "prefix of the CSV files, defaults to the bucket name")
+	objectsOnly := fs.Bool("objects-only", false, "only count real objects in the first column, like 'mc ls --recursive' does, and not prefixes")
+	diskPath, bucket, err := parseBucketArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	opts.Bucket = bucket
+	if cfg.MinFolders > cfg.MaxFolders || cfg.FilesPerFolder < 1 {
+		return fmt.Errorf("nothing to do for folders %d to %d with %d files per folder",
+			cfg.MinFolders, cfg.MaxFolders, cfg.FilesPerFolder)
+	}
+	if sf.inMemory {
+		return fmt.Errorf("sweep writes its objects to disk, --in-memory is not supported")
+	}
+	if *prefix == "" {
+		*prefix = strings.ReplaceAll(bucket, SlashSeparator, ".")
+	}
+
+	suffix := fmt.Sprintf("%d.%d.%d.csv", cfg.MinFolders, cfg.MaxFolders, cfg.FilesPerFolder)
+	putFile, err := os.OpenFile(*prefix+".PUT."+suffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer putFile.Close()
+	openFile, err := os.OpenFile(*prefix+".OPEN."+suffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer openFile.Close()
+
+	// Like 'tee -a', print the walk results and append them to the file.
+	openOut := io.MultiWriter(os.Stdout, openFile)
+	storage, err := sf.newStorage(diskPath, bucket, nil)
+	if err != nil {
+		return err
+	}
+	defer sf.close()
+	err = sweep(context.TODO(), storage, opts, cfg,
+		func(took time.Duration) error {
+			_, err := fmt.Fprintf(putFile, "%f\n", took.Seconds())
+			return err
+		},
+		func(res walkResult, took time.Duration) error {
+			count := res.Entries
+			if *objectsOnly {
+				count = res.RealObjects()
+			}
+			_, err := fmt.Fprintf(openOut, "%d;%f\n", count, took.Seconds())
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	if err := putFile.Close(); err != nil {
+		return err
+	}
+	return openFile.Close()
+}
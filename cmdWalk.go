@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// addWalkDirFlags registers one flag per WalkDirOptions field, except the
+// bucket, which is taken from the path argument.
+func addWalkDirFlags(fs *flag.FlagSet, opts *WalkDirOptions) {
+	fs.StringVar(&opts.BaseDir, "base-dir", "", "directory inside the bucket to start the walk in (WalkDirOptions.BaseDir)")
+	fs.BoolVar(&opts.Recursive, "recursive", true, "do a full recursive scan (WalkDirOptions.Recursive)")
+	fs.BoolVar(&opts.ReportNotFound, "report-not-found", false, "report an error if the base dir cannot be found (WalkDirOptions.ReportNotFound)")
+	fs.StringVar(&opts.FilterPrefix, "prefix", "", "only return entries with this prefix within the base dir, must not contain a slash (WalkDirOptions.FilterPrefix)")
+	fs.StringVar(&opts.ForwardTo, "forward-to", "", "forward to the given object path (WalkDirOptions.ForwardTo)")
+}
+
+// storageFlags configure the xlStorage a command walks.
+type storageFlags struct {
+	concurrency int
+	inMemory    bool
+	delay       delayConfig
+	delayOps    string
+	faults      string
+	faultSeed   int64
+	tracePath   string
+	chromePath  string
+
+	// injector is the fault injector of the last storage created, if
+	// faults are configured.
+	injector *faultFS
+	// tracer records the calls of all storages created, if --trace is set.
+	tracer *tracer
+	// timeline records the spans of all storages created, if
+	// --chrome-trace is set.
+	timeline *timeline
+}
+
+func (f *storageFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.concurrency, "concurrency", 1, "number of parallel ListDir and readMetadata calls, 1 walks synchronously")
+	fs.BoolVar(&f.inMemory, "in-memory", false, "load the bucket into memory first and walk the copy, to measure the walk without the disk")
+	fs.DurationVar(&f.delay.Fixed, "delay", 0, "add this latency to every filesystem call, e.g. 500us")
+	fs.DurationVar(&f.delay.Random, "delay-random", 0, "add a uniformly random latency between 0 and this to every filesystem call")
+	fs.DurationVar(&f.delay.PerDepth, "delay-per-depth", 0, "add this latency per directory level below the disk path to every filesystem call")
+	fs.Float64Var(&f.delay.Jitter, "delay-jitter", 0, "vary every delay randomly by up to this fraction, 0.1 is ±10%")
+	fs.Float64Var(&f.delay.OutlierProb, "delay-outlier-prob", 0, "probability that a filesystem call is an outlier")
+	fs.DurationVar(&f.delay.Outlier, "delay-outlier", 100*time.Millisecond, "latency added to outliers")
+	fs.Int64Var(&f.delay.Seed, "delay-seed", 1, "seed of the random delays")
+	fs.StringVar(&f.delayOps, "delay-ops", "all", "comma separated calls to delay: readdir, open, stat, read or all")
+	fs.StringVar(&f.faults, "faults", "", "inject faults, comma separated kind=probability or kind=every:N, kinds are eio, vanish, notdir, emfile and truncate")
+	fs.Int64Var(&f.faultSeed, "fault-seed", 1, "seed of the random faults")
+	fs.StringVar(&f.tracePath, "trace", "", "record every filesystem call as JSON lines in this file, see 'replay'")
+	fs.StringVar(&f.chromePath, "chrome-trace", "", "write a timeline of every scanDir and filesystem operation to this file, in the Chrome Trace Event format Perfetto opens")
+}
+
+// newStorage returns an xlStorage for the bucket below the disk path,
+// configured by the flags. stats is passed in, rather than set
+// afterwards, so the filesystem can record Stat fallbacks in it.
+func (f *storageFlags) newStorage(diskPath, bucket string, stats *walkStats) (*xlStorage, error) {
+	s := &xlStorage{
+		diskPath:        diskPath,
+		walkConcurrency: f.concurrency,
+		stats:           stats,
+	}
+	if f.inMemory {
+		volumeDir, err := s.getVolDir(bucket)
+		if err != nil {
+			return nil, err
+		}
+		m, err := loadMemFS(volumeDir)
+		if osIsNotExist(err) {
+			return nil, errVolumeNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		// loadMemFS makes the path absolute.
+		if s.diskPath, err = filepath.Abs(diskPath); err != nil {
+			return nil, err
+		}
+		s.fs = m
+	}
+
+	faults, err := parseFaults(f.faults)
+	if err != nil {
+		return nil, fmt.Errorf("--faults: %w", err)
+	}
+	if faults.enabled() {
+		faults.Seed = f.faultSeed
+		volumeDir, err := s.getVolDir(bucket)
+		if err != nil {
+			return nil, err
+		}
+		f.injector = newFaultFS(s.filesystem(), volumeDir, faults)
+		s.fs = f.injector
+	}
+
+	if f.delay.Ops, err = parseDelayOps(f.delayOps); err != nil {
+		return nil, fmt.Errorf("--delay-ops: %w", err)
+	}
+	if f.delay.enabled() {
+		s.fs = newDelayFS(s.filesystem(), s.diskPath, f.delay)
+	}
+
+	if f.tracePath != "" {
+		if f.tracer == nil {
+			if f.tracer, err = newTracer(f.tracePath); err != nil {
+				return nil, err
+			}
+		}
+		s.fs = newTraceFS(s.filesystem(), s.diskPath, f.tracer)
+	}
+
+	if f.chromePath != "" {
+		if f.timeline == nil {
+			f.timeline = newTimeline(s.diskPath)
+		}
+		s.timeline = f.timeline
+	}
+	return s, nil
+}
+
+// close flushes the trace and writes the timeline, if any. Errors are
+// printed, the walk itself succeeded.
+func (f *storageFlags) close() {
+	if f.tracer != nil {
+		if err := f.tracer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: --trace: %v\n", os.Args[0], err)
+		}
+		f.tracer = nil
+	}
+	if f.timeline != nil {
+		if err := f.timeline.writeFile(f.chromePath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: --chrome-trace: %v\n", os.Args[0], err)
+		}
+		f.timeline = nil
+	}
+}
+
+// parseBucketArgs parses the flags of a subcommand and expects exactly
+// one remaining argument, the path to the MinIO bucket.
+func parseBucketArgs(fs *flag.FlagSet, args []string) (diskPath, bucket string, err error) {
+	if err := fs.Parse(args); err != nil {
+		return "", "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", "", fmt.Errorf("%s: expected exactly one path to a MinIO bucket, got %d arguments", fs.Name(), fs.NArg())
+	}
+	diskPath, bucket = splitBucketPath(fs.Arg(0))
+	return diskPath, bucket, nil
+}
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\nFlags:\n", os.Args[0], name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runWalk runs a single WalkDir and prints a CSV line with the number
+// of entries, the duration in seconds and the number of objects, prefixes,
+// directory objects and legacy objects. With --objects-only the first
+// column only counts objects. With --print the entry names are written
+// to stdout instead and the CSV line goes to stderr. --format json
+// prints the same numbers as JSON.
+//
+// --timings, --histograms and injected faults are reported in comment
+// lines below the CSV output in every mode. --format json and
+// --objects-only only apply to a single walk.
+//
+// With --max-keys the listing is split into pages like S3 ListObjectsV2
+// does and one CSV line per page is printed instead:
+// page number, keys on the page, duration in seconds and the
+// continuation token for the next page.
+//
+// With --delimiter the walk is not recursive and the CSV line holds the
+// number of objects, the number of common prefixes and the duration.
+//
+// With --hide-deleted objects whose latest version is a delete marker
+// are not listed and not counted, like MinIO's ListObjects does. Their
+// number is reported in a '# deleted' line.
+//
+// With --versions every xl.meta is decoded and the listing has one entry
+// per version like S3 ListObjectVersions. One CSV line per page is
+// printed: page number, keys, versions, delete markers, duration in
+// seconds and the key and version-id markers of the next page. Without
+// --max-keys there is a single page.
+func runWalk(args []string) error {
+	var opts WalkDirOptions
+	var sf storageFlags
+	fs := newFlagSet("walk", "<path/to/minio/bucket>")
+	addWalkDirFlags(fs, &opts)
+	sf.register(fs)
+	printNames := fs.Bool("print", false, "print the name of every entry in the order MinIO would send it")
+	maxKeys := fs.Int("max-keys", 0, "split the listing into pages of at most this many keys, 0 lists everything in one walk")
+	token := fs.String("continuation-token", "", "start the paginated listing at this continuation token (requires --max-keys)")
+	maxPages := fs.Int("max-pages", 0, "stop the paginated listing after this many pages, 0 lists all pages")
+	objectsOnly := fs.Bool("objects-only", false, "only count real objects in the first column, like 'mc ls --recursive' does, and not prefixes")
+	format := fs.String("format", "csv", "output format of the result, csv or json")
+	timings := fs.Bool("timings", false, "record the time and calls of every filesystem operation and report them next to the total")
+	histograms := fs.Bool("histograms", false, "record and report latency percentiles of every filesystem operation")
+	delimiter := fs.String("delimiter", "", "list objects and common prefixes separately like S3 does for this delimiter, only '/' is supported")
+	hideDeleted := fs.Bool("hide-deleted", false, "decode every xl.meta and hide objects whose latest version is a delete marker like S3 ListObjects")
+	versions := fs.Bool("versions", false, "decode every xl.meta and list one entry per version and delete marker like S3 ListObjectVersions")
+	keyMarker := fs.String("key-marker", "", "start the versions listing after this key (requires --versions)")
+	versionIDMarker := fs.String("version-id-marker", "", "start the versions listing after this version of --key-marker (requires --versions)")
+	diskPath, bucket, err := parseBucketArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	opts.Bucket = bucket
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected csv or json", *format)
+	}
+	if (*versions || *delimiter != "" || *maxKeys > 0) && (*format != "csv" || *objectsOnly) {
+		return fmt.Errorf("--format and --objects-only only apply to a single walk, not to --versions, --delimiter or --max-keys")
+	}
+
+	var stats *walkStats
+	if *timings || *histograms {
+		stats = &walkStats{}
+	}
+	storage, err := sf.newStorage(diskPath, bucket, stats)
+	if err != nil {
+		return err
+	}
+	defer sf.close()
+	// comments adds what was recorded besides the entries to rep, it is
+	// printed in every mode.
+	comments := func(rep walkReport) walkReport {
+		if *timings {
+			rep.Operations = storage.stats.timings()
+		}
+		if *histograms {
+			rep.Latencies = storage.stats.histograms()
+		}
+		if sf.injector != nil {
+			rep.Faults = faultCounts(sf.injector.faults())
+		}
+		return rep
+	}
+	start := time.Now()
+
+	summary := os.Stdout
+	out := func(metaCacheEntry) {}
+	if *printNames {
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		out = func(entry metaCacheEntry) {
+			fmt.Fprintln(w, entry.name)
+		}
+		summary = os.Stderr
+	}
+
+	var filter *deleteMarkerFilter
+	if *hideDeleted {
+		if *versions || *delimiter != "" {
+			return fmt.Errorf("--hide-deleted cannot be combined with --versions or --delimiter")
+		}
+		filter = &deleteMarkerFilter{}
+	}
+
+	if *versions {
+		if *delimiter != "" || *token != "" {
+			return fmt.Errorf("--versions cannot be combined with --delimiter or --continuation-token")
+		}
+		var w *bufio.Writer
+		if *printNames {
+			w = bufio.NewWriter(os.Stdout)
+			defer w.Flush()
+		}
+		var first time.Duration
+		var total versionsPage
+		err := storage.listObjectVersions(context.TODO(), opts, *maxKeys, *keyMarker, *versionIDMarker, *maxPages, func(v objectInfo) {
+			if w != nil {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", v.Name, v.VersionID, v.Type, v.Size, v.ModTime.Format(time.RFC3339Nano))
+			}
+		}, func(p versionsPage) {
+			if p.Number == 1 {
+				first = time.Since(start)
+			}
+			printWalkErrors(p.Errors)
+			total.Number = p.Number
+			total.Keys += p.Keys
+			total.Versions += p.Versions
+			total.DeleteMarkers += p.DeleteMarkers
+			fmt.Fprintf(summary, "%d;%d;%d;%d;%f;%s;%s\n", p.Number, p.Keys, p.Versions, p.DeleteMarkers,
+				p.Duration.Seconds(), p.NextKeyMarker, p.NextVersionIDMarker)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "# %d pages, %d keys, %d versions, %d delete markers, time to first page %fs, total %fs\n",
+			total.Number, total.Keys, total.Versions, total.DeleteMarkers, first.Seconds(), time.Since(start).Seconds())
+		printComments(summary, comments(walkReport{}))
+		return nil
+	}
+	if *keyMarker != "" || *versionIDMarker != "" {
+		return fmt.Errorf("--key-marker and --version-id-marker require --versions")
+	}
+
+	if *delimiter != "" {
+		if *maxKeys > 0 {
+			return fmt.Errorf("--delimiter and --max-keys cannot be combined")
+		}
+		var w *bufio.Writer
+		if *printNames {
+			w = bufio.NewWriter(os.Stdout)
+			defer w.Flush()
+		}
+		res, err := storage.listDelimited(context.TODO(), opts, *delimiter, func(entry metaCacheEntry, isPrefix bool) {
+			switch {
+			case w == nil:
+			case isPrefix:
+				fmt.Fprintf(w, "PRE %s\n", entry.name)
+			default:
+				fmt.Fprintln(w, entry.name)
+			}
+		})
+		printWalkErrors(res.Errors)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(summary, "%d;%d;%f\n", len(res.Objects), len(res.CommonPrefixes), time.Since(start).Seconds())
+		printComments(summary, comments(walkReport{}))
+		return nil
+	}
+
+	if *maxKeys > 0 {
+		var first time.Duration
+		pages, keys := 0, 0
+		var keep func(metaCacheEntry) bool
+		if filter != nil {
+			keep = filter.keep
+		}
+		err := storage.listPages(context.TODO(), opts, *maxKeys, *token, *maxPages, keep, out, func(p listPage) {
+			if p.Number == 1 {
+				first = time.Since(start)
+			}
+			printWalkErrors(p.Errors)
+			pages++
+			keys += p.Keys
+			fmt.Fprintf(summary, "%d;%d;%f;%s\n", p.Number, p.Keys, p.Duration.Seconds(), p.ContinuationToken)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "# %d pages, %d keys, time to first page %fs, total %fs\n",
+			pages, keys, first.Seconds(), time.Since(start).Seconds())
+		var rep walkReport
+		if filter != nil {
+			printWalkErrors(filter.errors)
+			rep.Deleted = &filter.hidden.Entries
+		}
+		printComments(summary, comments(rep))
+		return nil
+	}
+
+	if filter != nil {
+		unfiltered := out
+		out = func(entry metaCacheEntry) {
+			if filter.keep(entry) {
+				unfiltered(entry)
+			}
+		}
+	}
+	// Use MinIO code!!!
+	res, err := storage.WalkDir(context.TODO(), opts, out)
+	totalTime := time.Since(start)
+	printWalkErrors(res.Errors)
+	if err != nil {
+		return err
+	}
+	rep := walkReport{
+		walkResult: res,
+		Seconds:    totalTime.Seconds(),
+	}
+	if filter != nil {
+		printWalkErrors(filter.errors)
+		rep.subtract(filter.hidden)
+		rep.Deleted = &filter.hidden.Entries
+	}
+	return printWalkResult(summary, *format, *objectsOnly, comments(rep))
+}
+
+// walkReport is the JSON output of a walk.
+type walkReport struct {
+	walkResult
+	Seconds float64 `json:"seconds"`
+	// Operations is the time spent per filesystem operation, if recorded.
+	Operations []opTiming `json:"operations,omitempty"`
+	// Latencies is the latency distribution per filesystem operation, if recorded.
+	Latencies []histogramSummary `json:"latencies,omitempty"`
+	// Faults is the number of injected faults per kind, if any.
+	Faults map[string]int `json:"faults,omitempty"`
+	// Deleted is the number of objects hidden because their latest
+	// version is a delete marker, if they were hidden.
+	Deleted *int `json:"deleted,omitempty"`
+}
+
+// printWalkResult prints the result of a walk in the given format. The
+// first two CSV columns are the count and duration the plot and sweep
+// scripts expect, followed by the breakdown per kind of entry and the
+// comment lines of printComments.
+func printWalkResult(w io.Writer, format string, objectsOnly bool, rep walkReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	count := rep.Entries
+	if objectsOnly {
+		count = rep.RealObjects()
+	}
+	_, err := fmt.Fprintf(w, "%d;%f;%d;%d;%d;%d\n", count, rep.Seconds,
+		rep.Objects, rep.Prefixes, rep.DirObjects, rep.LegacyObjects)
+	printComments(w, rep)
+	return err
+}
+
+// printComments prints the operation timings of rep as comment lines,
+// as operation;calls;seconds;average seconds, followed by the latency
+// percentiles, the injected faults and the hidden delete-marked objects.
+func printComments(w io.Writer, rep walkReport) {
+	printTimings(w, rep.Operations)
+	printHistograms(w, rep.Latencies)
+	if len(rep.Faults) > 0 {
+		fmt.Fprintf(w, "# faults;%s\n", formatFaultCounts(rep.Faults))
+	}
+	if rep.Deleted != nil {
+		fmt.Fprintf(w, "# deleted;%d\n", *rep.Deleted)
+	}
+}
+
+// printWalkErrors writes the errors WalkDir skipped to stderr, so they
+// do not end up in the CSV output.
+func printWalkErrors(errs []walkError) {
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	}
+}
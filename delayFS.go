@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// delayOp is a kind of filesystem call a delayFS slows down.
+type delayOp int
+
+const (
+	delayReadDir delayOp = 1 << iota
+	delayOpen
+	delayStat
+	delayRead
+
+	delayAllOps = delayReadDir | delayOpen | delayStat | delayRead
+)
+
+// parseDelayOps parses a comma separated list of readdir, open, stat and
+// read.
+func parseDelayOps(s string) (delayOp, error) {
+	var ops delayOp
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "readdir":
+			ops |= delayReadDir
+		case "open":
+			ops |= delayOpen
+		case "stat":
+			ops |= delayStat
+		case "read":
+			ops |= delayRead
+		case "all":
+			ops |= delayAllOps
+		default:
+			return 0, fmt.Errorf("unknown operation %q, expected readdir, open, stat, read or all", name)
+		}
+	}
+	return ops, nil
+}
+
+// delayConfig describes the latency a delayFS adds to every call. The
+// delay of a call is
+//
+//	(Fixed + rand(0, Random) + PerDepth*depth) * (1 ± rand(0, Jitter))
+//
+// where depth is the number of path elements below the disk path. With
+// probability OutlierProb Outlier is added on top.
+type delayConfig struct {
+	Ops         delayOp
+	Fixed       time.Duration
+	Random      time.Duration
+	PerDepth    time.Duration
+	Jitter      float64
+	OutlierProb float64
+	Outlier     time.Duration
+	Seed        int64
+}
+
+// enabled returns if the config adds any delay.
+func (c delayConfig) enabled() bool {
+	return c.Ops != 0 && (c.Fixed > 0 || c.Random > 0 || c.PerDepth > 0 || (c.OutlierProb > 0 && c.Outlier > 0))
+}
+
+// delayFS adds latency to the calls of another walkFS, to simulate slow
+// network filesystems like GlusterFS over FUSE on a local disk.
+type delayFS struct {
+	fs   walkFS
+	root string
+	cfg  delayConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newDelayFS(fs walkFS, root string, cfg delayConfig) *delayFS {
+	return &delayFS{fs: fs, root: root, cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// delay returns the delay for a call of op on name.
+func (d *delayFS) delay(op delayOp, name string) time.Duration {
+	if d.cfg.Ops&op == 0 {
+		return 0
+	}
+	rel := strings.Trim(strings.TrimPrefix(name, d.root), SlashSeparator)
+	depth := 0
+	if rel != "" {
+		depth = strings.Count(rel, SlashSeparator) + 1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delay := float64(d.cfg.Fixed + d.cfg.PerDepth*time.Duration(depth))
+	if d.cfg.Random > 0 {
+		delay += float64(d.rng.Int63n(int64(d.cfg.Random)))
+	}
+	if d.cfg.Jitter > 0 {
+		delay *= 1 + d.cfg.Jitter*(2*d.rng.Float64()-1)
+	}
+	if d.cfg.OutlierProb > 0 && d.rng.Float64() < d.cfg.OutlierProb {
+		delay += float64(d.cfg.Outlier)
+	}
+	return time.Duration(delay)
+}
+
+func (d *delayFS) sleep(op delayOp, name string) {
+	if delay := d.delay(op, name); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (d *delayFS) ReadDir(dirPath string, count int) ([]string, error) {
+	d.sleep(delayReadDir, dirPath)
+	return d.fs.ReadDir(dirPath, count)
+}
+
+func (d *delayFS) Open(filePath string) (walkFile, error) {
+	d.sleep(delayOpen, filePath)
+	f, err := d.fs.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &delayFile{walkFile: f, d: d, name: filePath}, nil
+}
+
+func (d *delayFS) ReadFile(filePath string) ([]byte, error) {
+	d.sleep(delayOpen, filePath)
+	d.sleep(delayRead, filePath)
+	return d.fs.ReadFile(filePath)
+}
+
+func (d *delayFS) Lstat(name string) (os.FileInfo, error) {
+	d.sleep(delayStat, name)
+	return d.fs.Lstat(name)
+}
+
+func (d *delayFS) Access(name string) error {
+	d.sleep(delayStat, name)
+	return d.fs.Access(name)
+}
+
+// delayFile adds latency to the calls on a file opened by a delayFS.
+type delayFile struct {
+	walkFile
+	d    *delayFS
+	name string
+}
+
+func (f *delayFile) Read(p []byte) (int, error) {
+	f.d.sleep(delayRead, f.name)
+	return f.walkFile.Read(p)
+}
+
+func (f *delayFile) Stat() (os.FileInfo, error) {
+	f.d.sleep(delayStat, f.name)
+	return f.walkFile.Stat()
+}
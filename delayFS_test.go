@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayFSDelay(t *testing.T) {
+	cfg := delayConfig{Ops: delayOpen | delayRead, Fixed: time.Millisecond, PerDepth: 100 * time.Microsecond}
+	d := newDelayFS(newMemFS(), "/disk", cfg)
+	tests := []struct {
+		op    delayOp
+		name  string
+		delay time.Duration
+	}{
+		{delayOpen, "/disk", time.Millisecond},
+		{delayOpen, "/disk/bkt/", 1100 * time.Microsecond},
+		{delayRead, "/disk/bkt/a/xl.meta", 1300 * time.Microsecond},
+		{delayReadDir, "/disk/bkt", 0},
+		{delayStat, "/disk/bkt/a/xl.meta", 0},
+	}
+	for _, tc := range tests {
+		if got := d.delay(tc.op, tc.name); got != tc.delay {
+			t.Errorf("delay(%d, %q) = %v, want %v", tc.op, tc.name, got, tc.delay)
+		}
+	}
+
+	// Random delays and jitter stay within their bounds, outliers are
+	// added on top.
+	cfg = delayConfig{Ops: delayAllOps, Fixed: time.Millisecond, Random: time.Millisecond, Jitter: 0.5,
+		OutlierProb: 0.1, Outlier: time.Second, Seed: 1}
+	d = newDelayFS(newMemFS(), "/disk", cfg)
+	outliers := 0
+	for i := 0; i < 1000; i++ {
+		delay := d.delay(delayStat, "/disk")
+		if delay >= time.Second {
+			outliers++
+			delay -= time.Second
+		}
+		if delay < 500*time.Microsecond || delay >= 3*time.Millisecond {
+			t.Fatalf("got delay %v, want within [0.5ms, 3ms)", delay)
+		}
+	}
+	if outliers < 50 || outliers > 150 {
+		t.Errorf("got %d outliers in 1000 calls, want about 100", outliers)
+	}
+}
+
+// TestDelayFSCalls checks that every call sleeps for the delay of each
+// of its operations.
+func TestDelayFSCalls(t *testing.T) {
+	m := newMemFS()
+	if err := m.WriteFile("/disk/bkt/a/xl.meta", []byte("XL2 ")); err != nil {
+		t.Fatal(err)
+	}
+	const delay = 5 * time.Millisecond
+	d := newDelayFS(m, "/disk", delayConfig{Ops: delayAllOps, Fixed: delay})
+	var f walkFile
+	calls := []struct {
+		name string
+		ops  int
+		call func() error
+	}{
+		{"ReadDir", 1, func() error { _, err := d.ReadDir("/disk/bkt", -1); return err }},
+		{"Lstat", 1, func() error { _, err := d.Lstat("/disk/bkt/a"); return err }},
+		{"Access", 1, func() error { return d.Access("/disk/bkt/a/xl.meta") }},
+		// Opening and reading.
+		{"ReadFile", 2, func() error { _, err := d.ReadFile("/disk/bkt/a/xl.meta"); return err }},
+		{"Open", 1, func() (err error) { f, err = d.Open("/disk/bkt/a/xl.meta"); return err }},
+		{"Read", 1, func() error { _, err := f.Read(make([]byte, 4)); return err }},
+		{"Stat", 1, func() error { _, err := f.Stat(); return err }},
+	}
+	for _, c := range calls {
+		start := time.Now()
+		if err := c.call(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if took := time.Since(start); took < time.Duration(c.ops)*delay {
+			t.Errorf("%s took %v, want at least %v", c.name, took, time.Duration(c.ops)*delay)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
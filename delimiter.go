@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// delimiterListing is the result of an S3 listing with delimiter=/.
+type delimiterListing struct {
+	// Objects found directly in the listed prefix.
+	Objects []string
+	// CommonPrefixes found in the listed prefix, each ending with a slash.
+	CommonPrefixes []string
+	// Errors WalkDir skipped.
+	Errors []walkError
+}
+
+// listDelimited lists opts.BaseDir like S3 ListObjects with
+// delimiter=/ would. WalkDir is run non-recursively and its entries are
+// split into objects and common prefixes.
+//
+// Like MinIO, directory objects (stored as __XLDIR__) are returned as
+// common prefixes, except for the directory object of the base dir
+// itself, which WalkDir sends first when the base dir ends with a slash.
+// This object is listed as an object, e.g. listing 'photos/' returns the
+// object 'photos/' if it exists.
+func (s *xlStorage) listDelimited(ctx context.Context, opts WalkDirOptions, delimiter string, out func(entry metaCacheEntry, isPrefix bool)) (delimiterListing, error) {
+	var res delimiterListing
+	if delimiter != SlashSeparator {
+		return res, fmt.Errorf("unsupported delimiter %q, MinIO's WalkDir only supports %q", delimiter, SlashSeparator)
+	}
+	opts.Recursive = false
+
+	lastPrefix := ""
+	walkRes, err := s.WalkDir(ctx, opts, func(entry metaCacheEntry) {
+		if entry.name == opts.BaseDir || !strings.HasSuffix(entry.name, SlashSeparator) {
+			res.Objects = append(res.Objects, entry.name)
+			out(entry, false)
+			return
+		}
+		// A directory object and the directory holding objects below it
+		// are both sent, right after each other, but only make up a
+		// single common prefix.
+		if entry.name == lastPrefix {
+			return
+		}
+		lastPrefix = entry.name
+		res.CommonPrefixes = append(res.CommonPrefixes, entry.name)
+		out(entry, true)
+	})
+	res.Errors = walkRes.Errors
+	return res, err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListDelimited(t *testing.T) {
+	m := newMemFS()
+	meta := newInlineObject([]byte("data"), time.Unix(1, 0), [16]byte{1})
+	for _, name := range []string{
+		"a",
+		"docs/x",
+		"docs/y/z",
+		"photos" + globalDirSuffix,
+		"photos/cat",
+		"photos/2022" + globalDirSuffix,
+		"zebra",
+	} {
+		if err := m.WriteFile("/disk/bkt/"+name+"/"+xlStorageFormatFile, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &xlStorage{diskPath: "/disk", fs: m}
+
+	tests := []struct {
+		name     string
+		baseDir  string
+		objects  []string
+		prefixes []string
+	}{
+		// photos/ is both a directory object and the directory holding
+		// photos/cat, but a single common prefix.
+		{"bucket", "", []string{"a", "zebra"}, []string{"docs/", "photos/"}},
+		{"prefix", "docs/", []string{"docs/x"}, []string{"docs/y/"}},
+		// The directory object of the base dir is listed as an object,
+		// the one below it as a common prefix.
+		{"directory object", "photos/", []string{"photos/", "photos/cat"}, []string{"photos/2022/"}},
+		{"missing", "nothere/", nil, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var objects, prefixes []string
+			res, err := s.listDelimited(context.Background(), WalkDirOptions{Bucket: "bkt", BaseDir: tc.baseDir}, SlashSeparator,
+				func(entry metaCacheEntry, isPrefix bool) {
+					if isPrefix {
+						prefixes = append(prefixes, entry.name)
+					} else {
+						objects = append(objects, entry.name)
+					}
+				})
+			if err != nil {
+				t.Fatalf("listDelimited: %v", err)
+			}
+			if !reflect.DeepEqual(objects, tc.objects) || !reflect.DeepEqual(res.Objects, tc.objects) {
+				t.Errorf("got objects %v, returned %v, want %v", objects, res.Objects, tc.objects)
+			}
+			if !reflect.DeepEqual(prefixes, tc.prefixes) || !reflect.DeepEqual(res.CommonPrefixes, tc.prefixes) {
+				t.Errorf("got common prefixes %v, returned %v, want %v", prefixes, res.CommonPrefixes, tc.prefixes)
+			}
+			if len(res.Errors) > 0 {
+				t.Errorf("got errors %v", res.Errors)
+			}
+		})
+	}
+
+	if _, err := s.listDelimited(context.Background(), WalkDirOptions{Bucket: "bkt"}, "-", func(metaCacheEntry, bool) {}); err == nil {
+		t.Errorf("listDelimited accepted delimiter %q", "-")
+	}
+}
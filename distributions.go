@@ -0,0 +1,88 @@
+package main
+
+import "math"
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b),
+// evaluated with the continued fraction of Numerical Recipes 6.4.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly for x < (a+1)/(a+b+2),
+	// use the symmetry I_x(a, b) = 1 - I_1-x(b, a) otherwise.
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaCF(b, a, 1-x)/b
+	}
+	return front * betaCF(a, b, x) / a
+}
+
+// betaCF evaluates the continued fraction for regIncBeta with the
+// modified Lentz method.
+func betaCF(a, b, x float64) float64 {
+	const (
+		maxIter = 300
+		eps     = 1e-14
+		tiny    = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
+
+// fSurvival returns P(F > f) for an F distribution with d1 and d2
+// degrees of freedom, the p-value of an F-test.
+func fSurvival(f, d1, d2 float64) float64 {
+	if f <= 0 {
+		return 1
+	}
+	return regIncBeta(d2/2, d1/2, d2/(d2+d1*f))
+}
+
+// tTwoSided returns P(|T| > |t|) for a Student t distribution with df
+// degrees of freedom, the p-value of a two-sided t-test.
+func tTwoSided(t, df float64) float64 {
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
@@ -31,6 +31,9 @@ var errFileAccessDenied = StorageErr("file access denied")
 // errTooManyOpenFiles - too many open files.
 var errTooManyOpenFiles = StorageErr("too many open files, please increase 'ulimit -n'")
 
+// errFileCorrupt - file has an unexpected size, or is not readable
+var errFileCorrupt = StorageErr("file is corrupted")
+
 func osIsNotExist(err error) bool {
 	return errors.Is(err, os.ErrNotExist)
 }
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// faultKind is a kind of fault a faultFS injects.
+type faultKind int
+
+const (
+	// faultEIO fails a call with EIO, like a broken disk or brick.
+	faultEIO faultKind = iota
+	// faultVanish fails a call with ENOENT, as if the file or directory
+	// was deleted between ListDir and reading it.
+	faultVanish
+	// faultNotDir fails a call with ENOTDIR, as if a directory in the path
+	// was replaced by a file.
+	faultNotDir
+	// faultTooManyFiles fails reading a directory or opening a file with
+	// EMFILE, as if the process ran out of file descriptors. Both open a
+	// file descriptor, checking a file with lstat or access does not.
+	faultTooManyFiles
+	// faultTruncate cuts the content of an xl.meta file in half.
+	faultTruncate
+
+	numFaultKinds
+)
+
+var faultNames = [numFaultKinds]string{"eio", "vanish", "notdir", "emfile", "truncate"}
+
+func (k faultKind) String() string {
+	return faultNames[k]
+}
+
+// changesLayout returns if the fault simulates a change of the tree
+// rather than an error. Entries lost to it are gone, not missing.
+func (k faultKind) changesLayout() bool {
+	return k == faultVanish || k == faultNotDir
+}
+
+// faultRule tells when to inject a fault: with probability Prob, or on
+// every Every-th call the fault applies to.
+type faultRule struct {
+	Prob  float64
+	Every int
+}
+
+// faultConfig configures a faultFS.
+type faultConfig struct {
+	Rules [numFaultKinds]faultRule
+	Seed  int64
+}
+
+// enabled returns if any fault is injected.
+func (c faultConfig) enabled() bool {
+	for _, r := range c.Rules {
+		if r.Prob > 0 || r.Every > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFaults parses a comma separated list of kind=rule, where the rule
+// is a probability like 0.01 or every:N to inject the fault on every
+// N-th call, e.g. "eio=0.01,truncate=every:50".
+func parseFaults(s string) (faultConfig, error) {
+	var cfg faultConfig
+	if s == "" {
+		return cfg, nil
+	}
+	for _, spec := range strings.Split(s, ",") {
+		name, rule, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok {
+			return cfg, fmt.Errorf("%q: expected kind=probability or kind=every:N", spec)
+		}
+		kind := faultKind(-1)
+		for k, n := range faultNames {
+			if n == name {
+				kind = faultKind(k)
+			}
+		}
+		if kind < 0 {
+			return cfg, fmt.Errorf("unknown fault %q, expected one of %s", name, strings.Join(faultNames[:], ", "))
+		}
+		if strings.HasPrefix(rule, "every:") {
+			n, err := strconv.Atoi(strings.TrimPrefix(rule, "every:"))
+			if err != nil || n < 1 {
+				return cfg, fmt.Errorf("%q: every needs a positive number of calls", spec)
+			}
+			cfg.Rules[kind].Every = n
+			continue
+		}
+		p, err := strconv.ParseFloat(rule, 64)
+		if err != nil || p < 0 || p > 1 {
+			return cfg, fmt.Errorf("%q: probability must be between 0 and 1", spec)
+		}
+		cfg.Rules[kind].Prob = p
+	}
+	return cfg, nil
+}
+
+// injectedFault is a fault a faultFS injected.
+type injectedFault struct {
+	Kind faultKind
+	Op   string
+	// Path relative to the root of the faultFS.
+	Path string
+}
+
+// faultFS injects errors into the calls of another walkFS, to test how
+// the walk copes with a flaky disk.
+type faultFS struct {
+	fs   walkFS
+	root string
+	cfg  faultConfig
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	calls    [numFaultKinds]int
+	injected []injectedFault
+}
+
+func newFaultFS(fs walkFS, root string, cfg faultConfig) *faultFS {
+	return &faultFS{fs: fs, root: root, cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// inject decides whether a call of op on name fails with one of kinds,
+// and records the fault if so. The first kind that fires wins.
+func (f *faultFS) inject(op, name string, kinds ...faultKind) (faultKind, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range kinds {
+		r := f.cfg.Rules[k]
+		f.calls[k]++
+		if (r.Every > 0 && f.calls[k]%r.Every == 0) || (r.Prob > 0 && f.rng.Float64() < r.Prob) {
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, f.root), SlashSeparator)
+			f.injected = append(f.injected, injectedFault{Kind: k, Op: op, Path: rel})
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// faults returns all injected faults in the order they were injected.
+func (f *faultFS) faults() []injectedFault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]injectedFault(nil), f.injected...)
+}
+
+// faultCounts returns the number of injected faults per kind, by name.
+func faultCounts(faults []injectedFault) map[string]int {
+	counts := make(map[string]int)
+	for _, fault := range faults {
+		counts[fault.Kind.String()]++
+	}
+	return counts
+}
+
+// formatFaultCounts prints fault counts sorted by kind, e.g.
+// "eio=3 vanish=1".
+func formatFaultCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, counts[name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// errno returns the error a fault of kind k causes for op on name.
+func (k faultKind) errno(op, name string) error {
+	var errno syscall.Errno
+	switch k {
+	case faultEIO:
+		errno = syscall.EIO
+	case faultVanish:
+		errno = syscall.ENOENT
+	case faultNotDir:
+		errno = syscall.ENOTDIR
+	case faultTooManyFiles:
+		errno = syscall.EMFILE
+	}
+	return &os.PathError{Op: op, Path: name, Err: errno}
+}
+
+func (f *faultFS) ReadDir(dirPath string, count int) ([]string, error) {
+	if k, ok := f.inject("readdir", dirPath, faultEIO, faultVanish, faultNotDir, faultTooManyFiles); ok {
+		// Map the error the way readDirWithOpts does.
+		if k == faultNotDir {
+			return nil, errFileNotFound
+		}
+		return nil, osErrToFileErr(k.errno("open", dirPath))
+	}
+	return f.fs.ReadDir(dirPath, count)
+}
+
+func (f *faultFS) Open(filePath string) (walkFile, error) {
+	if k, ok := f.inject("open", filePath, faultEIO, faultVanish, faultNotDir, faultTooManyFiles); ok {
+		return nil, k.errno("open", filePath)
+	}
+	file, err := f.fs.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if path.Base(filePath) == xlStorageFormatFile {
+		if _, ok := f.inject("read", filePath, faultTruncate); ok {
+			return newTruncatedFile(file)
+		}
+	}
+	return &faultFile{walkFile: file, f: f, name: filePath}, nil
+}
+
+func (f *faultFS) ReadFile(filePath string) ([]byte, error) {
+	if k, ok := f.inject("open", filePath, faultEIO, faultVanish, faultNotDir, faultTooManyFiles); ok {
+		return nil, k.errno("open", filePath)
+	}
+	return f.fs.ReadFile(filePath)
+}
+
+func (f *faultFS) Lstat(name string) (os.FileInfo, error) {
+	if k, ok := f.inject("lstat", name, faultEIO, faultVanish, faultNotDir); ok {
+		return nil, k.errno("lstat", name)
+	}
+	return f.fs.Lstat(name)
+}
+
+func (f *faultFS) Access(name string) error {
+	if k, ok := f.inject("access", name, faultEIO, faultVanish, faultNotDir); ok {
+		return k.errno("access", name)
+	}
+	return f.fs.Access(name)
+}
+
+// faultFile injects EIO into reads of a file opened by a faultFS.
+type faultFile struct {
+	walkFile
+	f    *faultFS
+	name string
+}
+
+func (file *faultFile) Read(p []byte) (int, error) {
+	if k, ok := file.f.inject("read", file.name, faultEIO); ok {
+		return 0, k.errno("read", file.name)
+	}
+	return file.walkFile.Read(p)
+}
+
+// truncatedFile returns only the first half of a file, but reports the
+// full size, like a file that was cut off while it was being read.
+type truncatedFile struct {
+	io.Reader
+	file walkFile
+}
+
+func newTruncatedFile(file walkFile) (walkFile, error) {
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &truncatedFile{Reader: io.LimitReader(file, st.Size()/2), file: file}, nil
+}
+
+func (t *truncatedFile) Stat() (os.FileInfo, error) {
+	return t.file.Stat()
+}
+
+func (t *truncatedFile) Close() error {
+	return t.file.Close()
+}
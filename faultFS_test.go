@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckFaults(t *testing.T) {
+	cfg := genConfig{Depth: 2, Fanout: 3, FilesPerDir: 8, DirObjectRatio: 0.2, LegacyRatio: 0.2,
+		EmptyDirs: 1, StrayFiles: 1, Versions: 1, Seed: 7}
+	for kind := faultKind(0); kind < numFaultKinds; kind++ {
+		for _, concurrency := range []int{0, 4} {
+			t.Run(fmt.Sprintf("%s/concurrency=%d", kind, concurrency), func(t *testing.T) {
+				s, _ := newGenStorage(t, cfg, concurrency)
+				clean, cleanRes := walkNames(t, s, WalkDirOptions{})
+				if len(cleanRes.Errors) > 0 {
+					t.Fatalf("walk without faults reported errors: %v", cleanRes.Errors)
+				}
+
+				var faults faultConfig
+				faults.Rules[kind].Prob = 0.1
+				faults.Seed = 1
+				injector := newFaultFS(s.filesystem(), "/disk/bkt", faults)
+				s.fs = injector
+				var faulty []string
+				res, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, func(e metaCacheEntry) {
+					faulty = append(faulty, e.name)
+				})
+				res = reportWalkError(res, err)
+				if len(injector.faults()) == 0 {
+					t.Fatalf("no %s fault was injected", kind)
+				}
+
+				rep := checkFaults(clean, faulty, res, injector.faults())
+				if !rep.OK {
+					t.Errorf("%d %s faults: unreported %v, unexpected %v", len(injector.faults()), kind, rep.Unreported, rep.Unexpected)
+				}
+			})
+		}
+	}
+}
+
+func TestFaultFSStat(t *testing.T) {
+	cfg := genConfig{Depth: 1, Fanout: 2, FilesPerDir: 3, Versions: 1, Seed: 5}
+	s, _ := newGenStorage(t, cfg, 0)
+	clean, _ := walkNames(t, s, WalkDirOptions{})
+
+	var faults faultConfig
+	faults.Rules[faultEIO].Every = 1
+	injector := newFaultFS(s.filesystem(), "/disk/bkt", faults)
+	if _, err := injector.Lstat("/disk/bkt/object00000/xl.meta"); !isSysErrIO(err) {
+		t.Errorf("Lstat: got error %v, want EIO", err)
+	}
+
+	// Checking the bucket fails the walk as a whole.
+	s.fs = injector
+	_, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, func(metaCacheEntry) {})
+	if err != errFaultyDisk {
+		t.Fatalf("WalkDir: got error %v, want %v", err, errFaultyDisk)
+	}
+	want := []injectedFault{{faultEIO, "lstat", "object00000/xl.meta"}, {faultEIO, "access", ""}}
+	if got := injector.faults(); !reflect.DeepEqual(got, want) {
+		t.Errorf("injected %v, want %v", got, want)
+	}
+	rep := checkFaults(clean, nil, reportWalkError(walkResult{}, err), injector.faults())
+	if !rep.OK || rep.MissingReported != len(clean) {
+		t.Errorf("%d of %d entries missing with a reported error, unreported %v", rep.MissingReported, len(clean), rep.Unreported)
+	}
+}
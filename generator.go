@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"time"
+)
+
+// genConfig describes a synthetic MinIO bucket.
+type genConfig struct {
+	// Depth is the number of directory levels below the bucket. Objects
+	// are created on every level.
+	Depth int
+	// Fanout is the number of sub directories per directory.
+	Fanout int
+	// FilesPerDir is the number of objects per directory.
+	FilesPerDir int
+	// DirObjectRatio is the share of objects stored as directory objects
+	// (__XLDIR__).
+	DirObjectRatio float64
+	// LegacyRatio is the share of objects stored as legacy xl.json.
+	LegacyRatio float64
+	// EmptyDirs is the number of empty directories, leftovers of deleted
+	// objects, per directory.
+	EmptyDirs int
+	// StrayFiles is the number of files per directory that are neither
+	// xl.meta nor xl.json.
+	StrayFiles int
+	// Versions is the number of versions per object. With more than one
+	// version, or delete markers, every version gets a version ID like in
+	// a bucket with versioning enabled.
+	Versions int
+	// DeleteMarkerRatio is the share of objects that were deleted, i.e.
+	// whose latest version is a delete marker.
+	DeleteMarkerRatio float64
+	// Seed of the random generator, the same seed generates the same tree.
+	Seed int64
+}
+
+// genResult counts what a generator created. The counts match the
+// result of a recursive walk over the whole bucket.
+type genResult struct {
+	Objects       int `json:"objects"`
+	DirObjects    int `json:"dirObjects"`
+	LegacyObjects int `json:"legacyObjects"`
+	Prefixes      int `json:"prefixes"`
+	EmptyDirs     int `json:"emptyDirs"`
+	StrayFiles    int `json:"strayFiles"`
+	// Versions of all objects, legacy objects included, without delete
+	// markers. This matches a ListObjectVersions of the whole bucket.
+	Versions      int `json:"versions"`
+	DeleteMarkers int `json:"deleteMarkers"`
+}
+
+// versioned returns if objects are generated with version IDs.
+func (cfg genConfig) versioned() bool {
+	return cfg.Versions > 1 || cfg.DeleteMarkerRatio > 0
+}
+
+// genFS is where a generator creates the bucket tree.
+type genFS interface {
+	MkdirAll(dirPath string) error
+	WriteFile(filePath string, data []byte) error
+}
+
+// osGenFS creates the bucket tree on disk.
+type osGenFS struct{}
+
+func (osGenFS) MkdirAll(dirPath string) error {
+	return os.MkdirAll(dirPath, 0777)
+}
+
+func (osGenFS) WriteFile(filePath string, data []byte) error {
+	if err := os.MkdirAll(path.Dir(filePath), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0666)
+}
+
+// legacyXLJSON returns a minimal xl.json of format v1 for an object.
+func legacyXLJSON(size int64, modTime time.Time) []byte {
+	return []byte(fmt.Sprintf(`{"version":"1.0.1","format":"xl","stat":{"size":%d,"modTime":%q},`+
+		`"erasure":{"algorithm":"klauspost/reedsolomon/vandermonde","data":1,"parity":0,"blockSize":%d,"index":1,`+
+		`"distribution":[1],"checksum":[{"name":"part.1","algorithm":"highwayhash256S"}]},`+
+		`"minio":{"release":"RELEASE.2019-10-12T01-39-57Z"},"meta":{"content-type":"application/octet-stream"},`+
+		`"parts":[{"number":1,"name":"part.1","etag":"","size":%d,"actualSize":%d}]}`,
+		size, modTime.UTC().Format(time.RFC3339Nano), blockSizeV2, size, size))
+}
+
+// generateBucket creates a synthetic bucket below bucketDir. Every
+// xl.meta is a valid v1.2 file with the object stored inline, so
+// checkXL2V1 and MinIO accept it.
+func generateBucket(fsys genFS, bucketDir string, cfg genConfig) (genResult, error) {
+	var res genResult
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	modTime := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	uuid := func() (u [16]byte) {
+		rng.Read(u[:])
+		u[6] = (u[6] & 0x0f) | 0x40
+		u[8] = (u[8] & 0x3f) | 0x80
+		return u
+	}
+
+	// objectMeta returns the xl.meta of an object holding data.
+	objectMeta := func(data []byte) []byte {
+		if !cfg.versioned() {
+			res.Versions++
+			return newInlineObject(data, modTime, uuid())
+		}
+		var versions []xlMetaV2Version
+		inline := make(map[string][]byte)
+		t := modTime
+		for v := 0; v < cfg.Versions; v++ {
+			obj := newInlineVersion(data, t, uuid())
+			obj.VersionID = uuid()
+			versions = append(versions, xlMetaV2Version{Type: ObjectType, ObjectV2: obj})
+			inline[formatVersionID(obj.VersionID)] = data
+			res.Versions++
+			t = t.Add(time.Millisecond)
+		}
+		if rng.Float64() < cfg.DeleteMarkerRatio {
+			versions = append(versions, xlMetaV2Version{Type: DeleteType, DeleteMarker: &xlMetaV2DeleteMarker{
+				VersionID: uuid(),
+				ModTime:   t.UnixNano(),
+			}})
+			res.DeleteMarkers++
+		}
+		return appendXLMetaV2(nil, versions, inline)
+	}
+
+	var gen func(dir string, depth int) error
+	gen = func(dir string, depth int) error {
+		if err := fsys.MkdirAll(dir); err != nil {
+			return err
+		}
+		for i := 0; i < cfg.FilesPerDir; i++ {
+			name := path.Join(dir, fmt.Sprintf("object%05d", i))
+			data := make([]byte, rng.Intn(128))
+			rng.Read(data)
+			modTime = modTime.Add(time.Second)
+			switch r := rng.Float64(); {
+			case r < cfg.DirObjectRatio:
+				res.DirObjects++
+				if err := fsys.WriteFile(path.Join(name+globalDirSuffix, xlStorageFormatFile), objectMeta(data)); err != nil {
+					return err
+				}
+			case r < cfg.DirObjectRatio+cfg.LegacyRatio:
+				res.LegacyObjects++
+				res.Versions++
+				if err := fsys.WriteFile(path.Join(name, xlStorageFormatFileV1), legacyXLJSON(int64(len(data)), modTime)); err != nil {
+					return err
+				}
+			default:
+				res.Objects++
+				if err := fsys.WriteFile(path.Join(name, xlStorageFormatFile), objectMeta(data)); err != nil {
+					return err
+				}
+			}
+		}
+		for i := 0; i < cfg.EmptyDirs; i++ {
+			res.EmptyDirs++
+			if err := fsys.MkdirAll(path.Join(dir, fmt.Sprintf("empty%05d", i))); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < cfg.StrayFiles; i++ {
+			res.StrayFiles++
+			if err := fsys.WriteFile(path.Join(dir, fmt.Sprintf("stray%05d.tmp", i)), []byte("stray")); err != nil {
+				return err
+			}
+		}
+		if depth >= cfg.Depth {
+			return nil
+		}
+		for i := 0; i < cfg.Fanout; i++ {
+			sub := path.Join(dir, fmt.Sprintf("dir%05d", i))
+			// WalkDir skips empty directories, but lists every other
+			// directory without metadata as a prefix.
+			if cfg.FilesPerDir > 0 || cfg.EmptyDirs > 0 || cfg.StrayFiles > 0 || (depth+1 < cfg.Depth && cfg.Fanout > 0) {
+				res.Prefixes++
+			}
+			if err := gen(sub, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return res, gen(bucketDir, 0)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// genTestConfigs are small trees covering every kind of entry the
+// generator creates.
+var genTestConfigs = []struct {
+	name string
+	cfg  genConfig
+}{
+	{"flat", genConfig{Depth: 0, Fanout: 0, FilesPerDir: 20, Versions: 1, Seed: 1}},
+	{"nested", genConfig{Depth: 2, Fanout: 3, FilesPerDir: 5, Versions: 1, Seed: 2}},
+	{"mixed", genConfig{Depth: 2, Fanout: 3, FilesPerDir: 8, DirObjectRatio: 0.2, LegacyRatio: 0.2,
+		EmptyDirs: 2, StrayFiles: 2, Versions: 1, Seed: 3}},
+	{"versioned", genConfig{Depth: 1, Fanout: 4, FilesPerDir: 6, DirObjectRatio: 0.1, LegacyRatio: 0.1,
+		Versions: 3, DeleteMarkerRatio: 0.3, Seed: 4}},
+}
+
+// newGenStorage generates a bucket "bkt" into a memFS and returns a
+// storage walking it.
+func newGenStorage(t *testing.T, cfg genConfig, concurrency int) (*xlStorage, genResult) {
+	t.Helper()
+	m := newMemFS()
+	gen, err := generateBucket(m, "/disk/bkt", cfg)
+	if err != nil {
+		t.Fatalf("generateBucket: %v", err)
+	}
+	return &xlStorage{diskPath: "/disk", fs: m, walkConcurrency: concurrency}, gen
+}
+
+// walkNames walks the whole bucket recursively and returns the names of
+// all entries in the order they were sent.
+func walkNames(t *testing.T, s *xlStorage, opts WalkDirOptions) ([]string, walkResult) {
+	t.Helper()
+	opts.Bucket = "bkt"
+	opts.Recursive = true
+	var names []string
+	res, err := s.WalkDir(context.Background(), opts, func(e metaCacheEntry) {
+		names = append(names, e.name)
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	return names, res
+}
+
+func TestGenerateBucketWalk(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		t.Run(tc.name, func(t *testing.T) {
+			s, gen := newGenStorage(t, tc.cfg, 0)
+			_, res := walkNames(t, s, WalkDirOptions{})
+			if len(res.Errors) > 0 {
+				t.Fatalf("walk reported errors: %v", res.Errors)
+			}
+			got := genResult{
+				Objects:       res.Objects,
+				DirObjects:    res.DirObjects,
+				LegacyObjects: res.LegacyObjects,
+				Prefixes:      res.Prefixes,
+				// A walk neither sends empty directories nor stray files.
+				EmptyDirs:     gen.EmptyDirs,
+				StrayFiles:    gen.StrayFiles,
+				Versions:      gen.Versions,
+				DeleteMarkers: gen.DeleteMarkers,
+			}
+			if got != gen {
+				t.Errorf("walk found %+v, generated %+v", got, gen)
+			}
+
+			var versions, deleteMarkers int
+			err := s.listObjectVersions(context.Background(), WalkDirOptions{Bucket: "bkt"}, 0, "", "", 0,
+				func(objectInfo) {}, func(p versionsPage) {
+					if len(p.Errors) > 0 {
+						t.Errorf("versions listing reported errors: %v", p.Errors)
+					}
+					versions += p.Versions
+					deleteMarkers += p.DeleteMarkers
+				})
+			if err != nil {
+				t.Fatalf("listObjectVersions: %v", err)
+			}
+			if versions != gen.Versions || deleteMarkers != gen.DeleteMarkers {
+				t.Errorf("listed %d versions and %d delete markers, generated %d and %d",
+					versions, deleteMarkers, gen.Versions, gen.DeleteMarkers)
+			}
+		})
+	}
+}
+
+func TestGenerateBucketDeterministic(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := newMemFS(), newMemFS()
+			if _, err := generateBucket(a, "/disk/bkt", tc.cfg); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := generateBucket(b, "/disk/bkt", tc.cfg); err != nil {
+				t.Fatal(err)
+			}
+			metadata := func(m *memFS) map[string][]byte {
+				s := &xlStorage{diskPath: "/disk", fs: m}
+				files := make(map[string][]byte)
+				_, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, func(e metaCacheEntry) {
+					files[e.name] = e.metadata
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return files
+			}
+			ma, mb := metadata(a), metadata(b)
+			if len(ma) != len(mb) {
+				t.Fatalf("got %d and %d entries with the same seed", len(ma), len(mb))
+			}
+			for name, buf := range ma {
+				if !bytes.Equal(buf, mb[name]) {
+					t.Errorf("%s: metadata differs with the same seed", name)
+				}
+			}
+		})
+	}
+}
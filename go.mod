@@ -1,10 +1,14 @@
-module main
+module walkdir
 
 go 1.18
 
 require golang.org/x/sys v0.0.0-20220608164250-635b8c9b7f68
 
 require (
-	github.com/dustin/go-humanize v1.0.0 // indirect
-	github.com/ncw/directio v1.0.5 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2
+	github.com/dustin/go-humanize v1.0.0
+	github.com/ncw/directio v1.0.5
+	github.com/tinylib/msgp v1.1.6
 )
+
+require github.com/philhofer/fwd v1.1.1 // indirect
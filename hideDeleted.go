@@ -0,0 +1,32 @@
+package main
+
+// deleteMarkerFilter hides objects whose latest version is a delete
+// marker, like MinIO's ListObjects does. WalkDir itself sends every
+// xl.meta it can read.
+type deleteMarkerFilter struct {
+	// hidden counts the hidden entries per kind.
+	hidden walkResult
+	// errors are metadata that could not be decoded. Those entries are
+	// kept, WalkDir could read them after all.
+	errors []walkError
+}
+
+// keep decodes the metadata of an object and returns false if its
+// latest version is a delete marker. Prefixes and legacy objects, which
+// cannot be deleted that way, are always kept.
+func (f *deleteMarkerFilter) keep(entry metaCacheEntry) bool {
+	if entry.kind != kindObject && entry.kind != kindDirObject {
+		return true
+	}
+	xl, err := loadXLMetaV2(entry.metadata)
+	if err != nil {
+		f.errors = append(f.errors, walkError{Op: "decode", Path: entry.name, Err: err})
+		return true
+	}
+	versions := xl.listVersions()
+	if len(versions) == 0 || versions[0].Type != DeleteType {
+		return true
+	}
+	f.hidden.count(entry.kind)
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteMarkerFilterGenerated(t *testing.T) {
+	cfg := genConfig{Depth: 1, Fanout: 3, FilesPerDir: 10, DirObjectRatio: 0.2, LegacyRatio: 0.1,
+		Versions: 2, DeleteMarkerRatio: 0.4, Seed: 6}
+	s, gen := newGenStorage(t, cfg, 0)
+	all, allRes := walkNames(t, s, WalkDirOptions{})
+
+	var filter deleteMarkerFilter
+	var kept []string
+	res, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, func(e metaCacheEntry) {
+		if filter.keep(e) {
+			kept = append(kept, e.name)
+		}
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	if gen.DeleteMarkers == 0 {
+		t.Fatal("no delete markers were generated")
+	}
+	// Every delete marker of the generator is the latest version.
+	if filter.hidden.Entries != gen.DeleteMarkers || len(all)-len(kept) != gen.DeleteMarkers {
+		t.Errorf("hid %d of %d entries, counted %d, generated %d delete markers",
+			len(all)-len(kept), len(all), filter.hidden.Entries, gen.DeleteMarkers)
+	}
+	if len(filter.errors) > 0 {
+		t.Errorf("got errors %v", filter.errors)
+	}
+
+	rep := walkReport{walkResult: res, Deleted: &filter.hidden.Entries}
+	rep.subtract(filter.hidden)
+	if rep.Entries != len(kept) || rep.Entries+filter.hidden.Entries != allRes.Entries {
+		t.Errorf("report counts %d entries, %d were kept", rep.Entries, len(kept))
+	}
+	var out bytes.Buffer
+	if err := printWalkResult(&out, "csv", false, rep); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("# deleted;%d\n", gen.DeleteMarkers); !strings.Contains(out.String(), want) {
+		t.Errorf("printed\n%s\nwithout %q", out.String(), want)
+	}
+}
+
+func TestDeleteMarkerFilter(t *testing.T) {
+	t0 := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	marker := func(t time.Time) xlMetaV2Version {
+		return xlMetaV2Version{Type: DeleteType, DeleteMarker: &xlMetaV2DeleteMarker{VersionID: [16]byte{3}, ModTime: t.UnixNano()}}
+	}
+	object := func(t time.Time) xlMetaV2Version {
+		obj := newInlineVersion(nil, t, [16]byte{1})
+		obj.VersionID = [16]byte{2}
+		return xlMetaV2Version{Type: ObjectType, ObjectV2: obj}
+	}
+	tests := []struct {
+		name   string
+		entry  metaCacheEntry
+		keep   bool
+		hidden walkResult
+		errors int
+	}{
+		{"latest delete marker", metaCacheEntry{name: "a", kind: kindObject,
+			metadata: appendXLMetaV2(nil, []xlMetaV2Version{object(t0), marker(t0.Add(time.Second))}, nil)},
+			false, walkResult{Entries: 1, Objects: 1}, 0},
+		// Versions are ordered by modification time, not as stored.
+		{"older delete marker", metaCacheEntry{name: "a", kind: kindObject,
+			metadata: appendXLMetaV2(nil, []xlMetaV2Version{marker(t0), object(t0.Add(time.Second))}, nil)},
+			true, walkResult{}, 0},
+		{"deleted directory object", metaCacheEntry{name: "a/", kind: kindDirObject,
+			metadata: appendXLMetaV2(nil, []xlMetaV2Version{marker(t0)}, nil)},
+			false, walkResult{Entries: 1, DirObjects: 1}, 0},
+		{"prefix", metaCacheEntry{name: "a/", kind: kindPrefix}, true, walkResult{}, 0},
+		{"legacy object", metaCacheEntry{name: "a", kind: kindLegacyObject, metadata: []byte("{}")}, true, walkResult{}, 0},
+		{"corrupt metadata", metaCacheEntry{name: "a", kind: kindObject, metadata: []byte("XL2 junk")}, true, walkResult{}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var f deleteMarkerFilter
+			if got := f.keep(tc.entry); got != tc.keep {
+				t.Errorf("keep returned %v, want %v", got, tc.keep)
+			}
+			if !reflect.DeepEqual(f.hidden, tc.hidden) {
+				t.Errorf("counted %+v hidden, want %+v", f.hidden, tc.hidden)
+			}
+			if len(f.errors) != tc.errors {
+				t.Errorf("got errors %v, want %d", f.errors, tc.errors)
+			}
+		})
+	}
+}
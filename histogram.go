@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Number of bits of precision of a latencyHistogram. Every power of two
+// is split into 1<<histSubBits linear buckets, which keeps the error of
+// any recorded value below 1%, like a HdrHistogram with two significant
+// digits.
+const (
+	histSubBits  = 7
+	histSubCount = 1 << histSubBits
+	// Values up to 1<<63 ns need this many groups of histSubCount buckets.
+	histBuckets = (64 - histSubBits + 1) * histSubCount
+)
+
+// latencyHistogram is a log-linear histogram of durations in the style
+// of HdrHistogram. It is safe for concurrent use.
+type latencyHistogram struct {
+	counts [histBuckets]int64
+	total  int64
+	sum    int64
+	max    int64
+}
+
+// histBucket returns the bucket of a value in nanoseconds.
+func histBucket(v uint64) int {
+	if v < histSubCount {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	group := exp - histSubBits + 1
+	mantissa := v >> uint(exp-histSubBits)
+	return group*histSubCount + int(mantissa-histSubCount)
+}
+
+// histBucketMax returns the highest value in nanoseconds a bucket holds.
+func histBucketMax(idx int) uint64 {
+	group, sub := idx/histSubCount, uint64(idx%histSubCount)
+	if group == 0 {
+		return sub
+	}
+	return (histSubCount+sub+1)<<uint(group-1) - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	atomic.AddInt64(&h.counts[histBucket(uint64(v))], 1)
+	atomic.AddInt64(&h.total, 1)
+	atomic.AddInt64(&h.sum, v)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if v <= max || atomic.CompareAndSwapInt64(&h.max, max, v) {
+			return
+		}
+	}
+}
+
+// quantile returns the value below which the fraction q of all recorded
+// values lie. Like HdrHistogram the highest value of the matching bucket
+// is returned, but never more than the maximum recorded.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	total := atomic.LoadInt64(&h.total)
+	if total == 0 {
+		return 0
+	}
+	want := int64(q*float64(total) + 0.5)
+	if want < 1 {
+		want = 1
+	}
+	max := atomic.LoadInt64(&h.max)
+	var seen int64
+	for i := range h.counts {
+		seen += atomic.LoadInt64(&h.counts[i])
+		if seen >= want {
+			v := int64(histBucketMax(i))
+			if v > max {
+				v = max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(max)
+}
+
+// histogramBucket is a non-empty bucket of an exported histogram.
+type histogramBucket struct {
+	// Upper bound of the bucket in seconds.
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// histogramSummary is the exported form of a latencyHistogram.
+// All values are in seconds.
+type histogramSummary struct {
+	Op      string            `json:"op"`
+	Count   int64             `json:"count"`
+	Mean    float64           `json:"mean"`
+	P50     float64           `json:"p50"`
+	P90     float64           `json:"p90"`
+	P99     float64           `json:"p99"`
+	P999    float64           `json:"p999"`
+	Max     float64           `json:"max"`
+	Buckets []histogramBucket `json:"buckets,omitempty"`
+}
+
+func (h *latencyHistogram) summary(op string) histogramSummary {
+	s := histogramSummary{
+		Op:    op,
+		Count: atomic.LoadInt64(&h.total),
+		P50:   h.quantile(0.5).Seconds(),
+		P90:   h.quantile(0.9).Seconds(),
+		P99:   h.quantile(0.99).Seconds(),
+		P999:  h.quantile(0.999).Seconds(),
+		Max:   time.Duration(atomic.LoadInt64(&h.max)).Seconds(),
+	}
+	if s.Count > 0 {
+		s.Mean = time.Duration(atomic.LoadInt64(&h.sum) / s.Count).Seconds()
+	}
+	for i := range h.counts {
+		if n := atomic.LoadInt64(&h.counts[i]); n > 0 {
+			s.Buckets = append(s.Buckets, histogramBucket{
+				LE:    time.Duration(histBucketMax(i)).Seconds(),
+				Count: n,
+			})
+		}
+	}
+	return s
+}
+
+// printHistograms writes one comment line per operation with its
+// latency percentiles, so the CSV output of a walk stays parsable.
+func printHistograms(w io.Writer, hists []histogramSummary) {
+	d := func(secs float64) time.Duration {
+		return time.Duration(secs * float64(time.Second)).Round(100 * time.Nanosecond)
+	}
+	for _, h := range hists {
+		fmt.Fprintf(w, "# %-12s count=%-8d p50=%-10v p90=%-10v p99=%-10v p999=%-10v max=%v\n",
+			h.Op, h.Count, d(h.P50), d(h.P90), d(h.P99), d(h.P999), d(h.Max))
+	}
+}
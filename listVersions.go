@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// versionsPage describes one page of a ListObjectVersions listing.
+type versionsPage struct {
+	// Number of the page, starting at 1.
+	Number int
+	// Keys is the number of distinct object names on this page.
+	Keys int
+	// Versions on this page, without delete markers.
+	Versions int
+	// DeleteMarkers on this page.
+	DeleteMarkers int
+	// Time it took to produce the page, including the WalkDir setup.
+	Duration time.Duration
+	// NextKeyMarker and NextVersionIDMarker request the next page. Both
+	// are empty on the last page.
+	NextKeyMarker       string
+	NextVersionIDMarker string
+	// Errors WalkDir skipped while producing the page, including
+	// metadata that could not be decoded.
+	Errors []walkError
+}
+
+// entryVersions decodes the metadata of an entry sent by WalkDir and
+// returns its versions, the latest first. Legacy objects have a single
+// version. Prefixes have none.
+func entryVersions(entry metaCacheEntry) ([]objectInfo, error) {
+	var versions []objectInfo
+	switch entry.kind {
+	case kindObject, kindDirObject:
+		xl, err := loadXLMetaV2(entry.metadata)
+		if err != nil {
+			return nil, err
+		}
+		versions = xl.listVersions()
+	case kindLegacyObject:
+		m, err := loadXLMetaV1(entry.metadata)
+		if err != nil {
+			return nil, err
+		}
+		versions = []objectInfo{m.objectInfo()}
+	default:
+		return nil, nil
+	}
+	for i := range versions {
+		versions[i].Name = entry.name
+	}
+	return versions, nil
+}
+
+// listObjectVersions emulates S3 ListObjectVersions of a recursive
+// listing. Every xl.meta is decoded and one entry per version, delete
+// markers included, is passed to out. Every page is a new WalkDir call
+// that resumes using ForwardTo and stops once maxKeys versions have been
+// returned. A page may end within the versions of an object.
+//
+// Listing starts after keyMarker, or after the version versionIDMarker
+// of keyMarker, if set. All versions of keyMarker are listed if
+// versionIDMarker is not one of them. With maxKeys <= 0 everything is
+// listed on a single page. Listing stops after maxPages pages, if
+// maxPages > 0.
+func (s *xlStorage) listObjectVersions(ctx context.Context, opts WalkDirOptions, maxKeys int, keyMarker, versionIDMarker string, maxPages int,
+	out func(objectInfo), page func(versionsPage)) error {
+	if versionIDMarker != "" && keyMarker == "" {
+		return fmt.Errorf("a version-id marker cannot be specified without a key marker")
+	}
+	opts.Recursive = true
+
+	for n := 1; maxPages <= 0 || n <= maxPages; n++ {
+		start := time.Now()
+		pageCtx, cancel := context.WithCancel(ctx)
+		pageOpts := opts
+		if keyMarker != "" {
+			pageOpts.ForwardTo = keyMarker
+		}
+
+		p := versionsPage{Number: n}
+		var last objectInfo
+		truncated := false
+		res, err := s.WalkDir(pageCtx, pageOpts, func(entry metaCacheEntry) {
+			if truncated || !entry.isObject() || entry.name < keyMarker {
+				return
+			}
+			if entry.name == keyMarker && versionIDMarker == "" {
+				return
+			}
+			versions, err := entryVersions(entry)
+			if err != nil {
+				p.Errors = append(p.Errors, walkError{Op: "decode", Path: entry.name, Err: err})
+				return
+			}
+			if entry.name == keyMarker {
+				for i, v := range versions {
+					if v.VersionID == versionIDMarker {
+						versions = versions[i+1:]
+						break
+					}
+				}
+			}
+			for i, v := range versions {
+				if maxKeys > 0 && p.Versions+p.DeleteMarkers == maxKeys {
+					// There is at least one more version, so there is a
+					// next page.
+					truncated = true
+					cancel()
+					return
+				}
+				if i == 0 {
+					p.Keys++
+				}
+				if v.Type == DeleteType {
+					p.DeleteMarkers++
+				} else {
+					p.Versions++
+				}
+				last = v
+				out(v)
+			}
+		})
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The walk of a truncated page was canceled on purpose.
+		if err != nil && !truncated {
+			return err
+		}
+
+		p.Duration = time.Since(start)
+		p.Errors = append(res.Errors, p.Errors...)
+		if truncated {
+			p.NextKeyMarker = last.Name
+			p.NextVersionIDMarker = last.VersionID
+		}
+		page(p)
+		if !truncated {
+			return nil
+		}
+		keyMarker, versionIDMarker = last.Name, last.VersionID
+	}
+	return nil
+}
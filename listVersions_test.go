@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestListObjectVersionsPages(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		s, _ := newGenStorage(t, tc.cfg, 0)
+		list := func(maxKeys int, page func(versionsPage, []objectInfo)) []objectInfo {
+			var all, onPage []objectInfo
+			err := s.listObjectVersions(context.Background(), WalkDirOptions{Bucket: "bkt"}, maxKeys, "", "", 0,
+				func(v objectInfo) {
+					all = append(all, v)
+					onPage = append(onPage, v)
+				}, func(p versionsPage) {
+					page(p, onPage)
+					onPage = nil
+				})
+			if err != nil {
+				t.Fatalf("listObjectVersions: %v", err)
+			}
+			return all
+		}
+		want := list(0, func(versionsPage, []objectInfo) {})
+		for _, maxKeys := range []int{1, 2, 5, 1000} {
+			t.Run(fmt.Sprintf("%s/max-keys=%d", tc.name, maxKeys), func(t *testing.T) {
+				got := list(maxKeys, func(p versionsPage, versions []objectInfo) {
+					names := make(map[string]bool)
+					for _, v := range versions {
+						names[v.Name] = true
+					}
+					if p.Keys != len(names) {
+						t.Errorf("page %d counted %d keys, it holds versions of %d", p.Number, p.Keys, len(names))
+					}
+					if n := p.Versions + p.DeleteMarkers; n != len(versions) || n > maxKeys {
+						t.Errorf("page %d counted %d versions, it holds %d, at most %d allowed", p.Number, n, len(versions), maxKeys)
+					}
+				})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("pages listed %d versions that differ from the %d of a single page", len(got), len(want))
+				}
+			})
+		}
+	}
+}
+
+func TestListObjectVersionsMarkers(t *testing.T) {
+	s, _ := newGenStorage(t, genTestConfigs[3].cfg, 0)
+	list := func(keyMarker, versionIDMarker string) []objectInfo {
+		var all []objectInfo
+		err := s.listObjectVersions(context.Background(), WalkDirOptions{Bucket: "bkt"}, 0, keyMarker, versionIDMarker, 0,
+			func(v objectInfo) {
+				all = append(all, v)
+			}, func(versionsPage) {})
+		if err != nil {
+			t.Fatalf("listObjectVersions: %v", err)
+		}
+		return all
+	}
+	all := list("", "")
+	// The second version of a key that has more than one.
+	i := 1
+	for ; i < len(all) && all[i].Name != all[i-1].Name; i++ {
+	}
+	if i == len(all) {
+		t.Fatal("no key with more than one version")
+	}
+	key := all[i].Name
+	first := i - 1
+	next := i + 1
+	for next < len(all) && all[next].Name == key {
+		next++
+	}
+
+	tests := []struct {
+		name            string
+		versionIDMarker string
+		want            []objectInfo
+	}{
+		{"key marker", "", all[next:]},
+		{"version-id marker", all[i].VersionID, all[i+1:]},
+		// All versions of the key marker are listed.
+		{"unknown version-id marker", "00000000-0000-0000-0000-000000000000", all[first:]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := list(key, tc.versionIDMarker)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("listed %d versions after %s %q, want the last %d of %d", len(got), key, tc.versionIDMarker, len(tc.want), len(all))
+			}
+		})
+	}
+}
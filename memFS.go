@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// memFS is an in-memory directory tree. Walks against it are
+// deterministic and measure the walk algorithm instead of the disk.
+// It implements walkFS and genFS, so the generator can fill it.
+type memFS struct {
+	mu   sync.RWMutex
+	root *memNode
+}
+
+// memNode is a file or directory of a memFS.
+type memNode struct {
+	name     string
+	dir      bool
+	children map[string]*memNode
+	data     []byte
+	modTime  time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{root: &memNode{name: "/", dir: true, children: map[string]*memNode{}}}
+}
+
+// split returns the elements of a cleaned absolute path.
+func (m *memFS) split(name string) []string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+	return strings.Split(name[1:], "/")
+}
+
+// lookup returns the node at name. The caller must hold m.mu.
+func (m *memFS) lookup(op, name string) (*memNode, error) {
+	n := m.root
+	for _, elem := range m.split(name) {
+		if !n.dir {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		child, ok := n.children[elem]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// mkdirAll creates name and all parents. The caller must hold m.mu.
+func (m *memFS) mkdirAll(name string) (*memNode, error) {
+	n := m.root
+	for _, elem := range m.split(name) {
+		if !n.dir {
+			return nil, &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		child, ok := n.children[elem]
+		if !ok {
+			child = &memNode{name: elem, dir: true, children: map[string]*memNode{}, modTime: time.Now()}
+			n.children[elem] = child
+		}
+		n = child
+	}
+	if !n.dir {
+		return nil, &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return n, nil
+}
+
+// MkdirAll creates a directory and all its parents.
+func (m *memFS) MkdirAll(dirPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.mkdirAll(dirPath)
+	return err
+}
+
+// WriteFile creates or replaces a file, creating all parent directories.
+func (m *memFS) WriteFile(filePath string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, err := m.mkdirAll(path.Dir(filePath))
+	if err != nil {
+		return err
+	}
+	name := path.Base(filePath)
+	if n, ok := dir.children[name]; ok && n.dir {
+		return &os.PathError{Op: "open", Path: filePath, Err: syscall.EISDIR}
+	}
+	dir.children[name] = &memNode{name: name, data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) ReadDir(dirPath string, count int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("open", dirPath)
+	if err != nil {
+		return nil, osErrToFileErr(err)
+	}
+	if !n.dir {
+		return nil, errFileNotFound
+	}
+	entries := make([]string, 0, len(n.children))
+	for name, child := range n.children {
+		if child.dir {
+			name += SlashSeparator
+		}
+		entries = append(entries, name)
+	}
+	// Sort, so walks are reproducible. Sorting by full name is close
+	// enough to the directory order of most filesystems.
+	sort.Strings(entries)
+	if count >= 0 && count < len(entries) {
+		entries = entries[:count]
+	}
+	return entries, nil
+}
+
+func (m *memFS) Open(filePath string) (walkFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("open", filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{Reader: bytes.NewReader(n.data), info: n.info()}, nil
+}
+
+func (m *memFS) ReadFile(filePath string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("open", filePath)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return nil, &os.PathError{Op: "read", Path: filePath, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+func (m *memFS) Lstat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+func (m *memFS) Access(name string) error {
+	_, err := m.Lstat(name)
+	return err
+}
+
+// loadMemFS copies the tree below root on disk into a new memFS, at the
+// same absolute paths. Symlinks and other special files are skipped.
+func loadMemFS(root string) (*memFS, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m := newMemFS()
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return m.MkdirAll(name)
+		case d.Type().IsRegular():
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			return m.WriteFile(name, data)
+		}
+		return nil
+	})
+	return m, err
+}
+
+// info returns the file info of a node.
+func (n *memNode) info() os.FileInfo {
+	return memFileInfo{n: n}
+}
+
+// memFile is a file of a memFS opened for reading.
+type memFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memFileInfo implements os.FileInfo for a memNode.
+type memFileInfo struct {
+	n *memNode
+}
+
+func (fi memFileInfo) Name() string       { return fi.n.name }
+func (fi memFileInfo) Size() int64        { return int64(len(fi.n.data)) }
+func (fi memFileInfo) ModTime() time.Time { return fi.n.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.n.dir }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.n.dir {
+		return os.ModeDir | 0777
+	}
+	return 0666
+}
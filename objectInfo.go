@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// objectInfo is a single version of an object as it is stored on a disk,
+// decoded from an xl.meta or a legacy xl.json file.
+type objectInfo struct {
+	// Name of the object, empty if a single metadata file was decoded.
+	Name string `json:"name,omitempty"`
+	// VersionID is "null" for objects written without versioning.
+	VersionID string `json:"versionId"`
+	// Type is object, deleteMarker or legacy.
+	Type     VersionType `json:"type"`
+	IsLatest bool        `json:"isLatest"`
+	ModTime  time.Time   `json:"modTime"`
+	Size     int64       `json:"size"`
+	DataDir  string      `json:"dataDir,omitempty"`
+	// Erasure is nil for delete markers.
+	Erasure      *erasureInfo      `json:"erasure,omitempty"`
+	Parts        []objectPartInfo  `json:"parts,omitempty"`
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+	// Inline is true if the data is stored in the metadata file itself.
+	Inline bool `json:"inline"`
+}
+
+// erasureInfo is the erasure layout of an object version.
+type erasureInfo struct {
+	Algorithm    string `json:"algorithm"`
+	Data         int    `json:"data"`
+	Parity       int    `json:"parity"`
+	BlockSize    int64  `json:"blockSize"`
+	Index        int    `json:"index"`
+	Distribution []int  `json:"distribution"`
+	// Checksum is the bitrot checksum algorithm.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// objectPartInfo is a single part of an object version.
+type objectPartInfo struct {
+	Number     int    `json:"number"`
+	ETag       string `json:"etag,omitempty"`
+	Size       int64  `json:"size"`
+	ActualSize int64  `json:"actualSize"`
+}
+
+// formatVersionID formats a version ID as UUID, the zero ID of objects
+// written without versioning as "null".
+func formatVersionID(id [16]byte) string {
+	if id == [16]byte{} {
+		return nullVersionID
+	}
+	return formatUUID(id)
+}
+
+// formatUUID formats 16 bytes in the canonical UUID form.
+func formatUUID(id [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf[:])
+}
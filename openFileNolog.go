@@ -1,39 +1,86 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 )
 
-var totalFiles int = 0
+// command is a single walkdir subcommand.
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "walk", short: "Run MinIO's WalkDir on a bucket and print count and duration", run: runWalk},
+		{name: "bench", short: "Run WalkDir repeatedly and report statistics over all runs", run: runBench},
+		{name: "sweep", short: "Grow a bucket folder by folder and walk it after every folder", run: runSweep},
+		{name: "inspect", short: "Decode a single xl.meta or xl.json file and print its versions as JSON", run: runInspect},
+		{name: "gen", short: "Create a synthetic MinIO bucket with valid xl.meta files", run: runGen},
+		{name: "plot", short: "Fit a line through sweep results and render them as SVG chart", run: runPlot},
+		{name: "compare", short: "Compare two result files and fail on a performance regression", run: runCompare},
+		{name: "fault-check", short: "Walk with injected faults and check every difference is reported", run: runFaultCheck},
+		{name: "replay", short: "Re-issue the filesystem calls of a trace against another disk", run: runReplay},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] <path/to/minio/bucket>\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Calling '%s <path>' without a command is the same as 'walk <path>'.\n", os.Args[0])
+}
 
-// Pass a file name as first argument
 func main() {
-	start := time.Now()
-	name := os.Args[1]
-	// filepath.WalkDir(name, visit)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
 
-	name = strings.TrimSuffix(name, SlashSeparator)
-	split := strings.Split(name, SlashSeparator)
-	basePath := strings.Join(split[:len(split)-1], SlashSeparator)
-	bucket := split[len(split)-1]
-	storage := &xlStorage{
-		diskPath: basePath,
+	name, args := os.Args[1], os.Args[2:]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+	run := runWalk
+	found := false
+	for _, c := range commands {
+		if c.name == name {
+			run = c.run
+			found = true
+			break
+		}
+	}
+	if !found {
+		// Keep the old calling convention working: './walkdir <path>'.
+		args = os.Args[1:]
 	}
-	opts := WalkDirOptions{
-		Bucket:         bucket,
-		BaseDir:        "",
-		Recursive:      true,
-		ReportNotFound: false,
-		FilterPrefix:   "",
-		ForwardTo:      "",
+
+	if err := run(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		os.Exit(1)
 	}
+}
 
-	// Use MinIO code!!!
-	totalFiles = storage.WalkDir(context.TODO(), opts)
-	totalTime := time.Since(start)
-	fmt.Printf("%d;%f\n", totalFiles, totalTime.Seconds())
+// splitBucketPath splits a path to a MinIO bucket into the disk path
+// and the bucket name, e.g. /gluster/export/bucket into /gluster/export
+// and bucket.
+func splitBucketPath(name string) (diskPath, bucket string) {
+	name = strings.TrimSuffix(name, SlashSeparator)
+	split := strings.Split(name, SlashSeparator)
+	diskPath = strings.Join(split[:len(split)-1], SlashSeparator)
+	bucket = split[len(split)-1]
+	return diskPath, bucket
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// listPage describes one page of a paginated listing.
+type listPage struct {
+	// Number of the page, starting at 1.
+	Number int
+	// Keys is the number of objects returned on this page.
+	Keys int
+	// Time it took to produce the page, including the WalkDir setup.
+	Duration time.Duration
+	// ContinuationToken to request the next page. Empty on the last page.
+	ContinuationToken string
+	// Errors WalkDir skipped while producing the page.
+	Errors []walkError
+}
+
+// encodeContinuationToken encodes the last key of a page the same way
+// MinIO does for ListObjectsV2.
+func encodeContinuationToken(marker string) string {
+	return base64.StdEncoding.EncodeToString([]byte(marker))
+}
+
+// decodeContinuationToken returns the marker stored in a continuation token.
+func decodeContinuationToken(token string) (string, error) {
+	marker, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid continuation token %q: %w", token, err)
+	}
+	return string(marker), nil
+}
+
+// listPages emulates S3 ListObjectsV2 pagination. Every page is a new
+// WalkDir call that resumes from the previous page using ForwardTo and
+// stops once maxKeys objects have been returned. Like S3, only objects
+// are keys: the prefixes WalkDir sends for directories are skipped, as
+// are entries for which keep returns false, keep may be nil. Objects
+// are passed to out and every finished page to page. Listing starts at
+// the given continuation token and stops after maxPages pages, if
+// maxPages > 0.
+func (s *xlStorage) listPages(ctx context.Context, opts WalkDirOptions, maxKeys int, token string, maxPages int,
+	keep func(metaCacheEntry) bool, out func(metaCacheEntry), page func(listPage)) error {
+	if maxKeys <= 0 {
+		return fmt.Errorf("max-keys must be positive, got %d", maxKeys)
+	}
+	marker := ""
+	if token != "" {
+		var err error
+		if marker, err = decodeContinuationToken(token); err != nil {
+			return err
+		}
+	}
+
+	for n := 1; maxPages <= 0 || n <= maxPages; n++ {
+		start := time.Now()
+		pageCtx, cancel := context.WithCancel(ctx)
+		pageOpts := opts
+		if marker != "" {
+			pageOpts.ForwardTo = marker
+		}
+
+		keys := 0
+		last := ""
+		truncated := false
+		res, err := s.WalkDir(pageCtx, pageOpts, func(entry metaCacheEntry) {
+			if truncated {
+				// WalkDir may send a few more entries before it notices
+				// the cancellation.
+				return
+			}
+			// ForwardTo only skips to the marker, it also sends the marker
+			// itself and the prefixes leading to it.
+			if marker != "" && entry.name <= marker {
+				return
+			}
+			if !entry.isObject() {
+				// S3 does not list prefixes in a recursive listing.
+				return
+			}
+			if keep != nil && !keep(entry) {
+				// Resume after it, so the next page does not check it again.
+				last = entry.name
+				return
+			}
+			if keys == maxKeys {
+				// There is at least one more entry, so there is a next page.
+				truncated = true
+				cancel()
+				return
+			}
+			keys++
+			last = entry.name
+			out(entry)
+		})
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The walk of a truncated page was canceled on purpose.
+		if err != nil && !truncated {
+			return err
+		}
+
+		p := listPage{Number: n, Keys: keys, Duration: time.Since(start), Errors: res.Errors}
+		if truncated {
+			p.ContinuationToken = encodeContinuationToken(last)
+		}
+		page(p)
+		if !truncated {
+			return nil
+		}
+		marker = last
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestListPagesMatchesWalk(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		for _, concurrency := range []int{0, 4} {
+			s, _ := newGenStorage(t, tc.cfg, concurrency)
+			var want []string
+			_, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, func(e metaCacheEntry) {
+				if e.isObject() {
+					want = append(want, e.name)
+				}
+			})
+			if err != nil {
+				t.Fatalf("WalkDir: %v", err)
+			}
+			for _, maxKeys := range []int{1, 7, 1000} {
+				t.Run(fmt.Sprintf("%s/concurrency=%d/max-keys=%d", tc.name, concurrency, maxKeys), func(t *testing.T) {
+					var got []string
+					keys, pages := 0, 0
+					err := s.listPages(context.Background(), WalkDirOptions{Bucket: "bkt", Recursive: true}, maxKeys, "", 0, nil,
+						func(e metaCacheEntry) {
+							got = append(got, e.name)
+						}, func(p listPage) {
+							pages++
+							keys += p.Keys
+							if p.Keys > maxKeys {
+								t.Errorf("page %d has %d keys, more than %d", p.Number, p.Keys, maxKeys)
+							}
+							if p.ContinuationToken != "" {
+								if marker, err := decodeContinuationToken(p.ContinuationToken); err != nil || marker != got[len(got)-1] {
+									t.Errorf("page %d: continuation token %q is not the last key %q", p.Number, marker, got[len(got)-1])
+								}
+							}
+						})
+					if err != nil {
+						t.Fatalf("listPages: %v", err)
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("pages listed\n%v\nwant the objects of a full walk\n%v", got, want)
+					}
+					if keys != len(want) {
+						t.Errorf("pages counted %d keys, want %d", keys, len(want))
+					}
+					if wantPages := (len(want) + maxKeys - 1) / maxKeys; pages != wantPages {
+						t.Errorf("got %d pages, want %d", pages, wantPages)
+					}
+				})
+			}
+		}
+	}
+}
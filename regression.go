@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// point is a single measurement, the number of entries and the duration
+// of a walk in seconds.
+type point struct {
+	X, Y float64
+}
+
+// readSeries reads the first two columns of the ';' separated CSV that
+// walk, bench and sweep write. Empty lines and comment lines starting
+// with '#' are skipped.
+func readSeries(r io.Reader) ([]point, error) {
+	var pts []point
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ";")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected at least two ';' separated columns, got %q", line, text)
+		}
+		x, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		y, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pts = append(pts, point{X: x, Y: y})
+	}
+	return pts, sc.Err()
+}
+
+// inRange returns the points with from <= X <= to.
+func inRange(pts []point, from, to float64) []point {
+	var res []point
+	for _, p := range pts {
+		if p.X >= from && p.X <= to {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// linearFit is the least squares fit of y = Slope*x + Intercept.
+type linearFit struct {
+	N         int     `json:"n"`
+	Slope     float64 `json:"slope"`
+	Intercept float64 `json:"intercept"`
+	// R2 is the coefficient of determination, 1 is a perfect fit.
+	R2 float64 `json:"r2"`
+}
+
+var errTooFewPoints = errors.New("at least two points with different counts are needed for a fit")
+
+// fitLinear fits a straight line through pts with ordinary least squares.
+func fitLinear(pts []point) (linearFit, error) {
+	fit := linearFit{N: len(pts)}
+	if len(pts) < 2 {
+		return fit, errTooFewPoints
+	}
+	var mx, my float64
+	for _, p := range pts {
+		mx += p.X
+		my += p.Y
+	}
+	mx /= float64(len(pts))
+	my /= float64(len(pts))
+
+	var sxx, sxy float64
+	for _, p := range pts {
+		sxx += (p.X - mx) * (p.X - mx)
+		sxy += (p.X - mx) * (p.Y - my)
+	}
+	if sxx == 0 {
+		return fit, errTooFewPoints
+	}
+	fit.Slope = sxy / sxx
+	fit.Intercept = my - fit.Slope*mx
+	fit.R2 = rSquared(pts, fit.at)
+	return fit, nil
+}
+
+// at returns the fitted duration for x entries.
+func (f linearFit) at(x float64) float64 {
+	return f.Slope*x + f.Intercept
+}
+
+// rSquared returns the coefficient of determination of the model f for
+// pts.
+func rSquared(pts []point, f func(float64) float64) float64 {
+	var my float64
+	for _, p := range pts {
+		my += p.Y
+	}
+	my /= float64(len(pts))
+	var ssRes, ssTot float64
+	for _, p := range pts {
+		ssRes += (p.Y - f(p.X)) * (p.Y - f(p.X))
+		ssTot += (p.Y - my) * (p.Y - my)
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1
+		}
+		return math.Inf(-1)
+	}
+	return 1 - ssRes/ssTot
+}
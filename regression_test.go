@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitLinear(t *testing.T) {
+	tests := []struct {
+		name      string
+		pts       []point
+		slope     float64
+		intercept float64
+		r2        float64
+	}{
+		{"exact", []point{{1, 3}, {2, 5}, {4, 9}}, 2, 1, 1},
+		// ssTot is 6, ssRes 2.4.
+		{"scattered", []point{{1, 2}, {2, 4}, {3, 5}, {4, 4}, {5, 5}}, 0.6, 2.2, 0.6},
+		{"flat", []point{{1, 7}, {2, 7}, {3, 7}}, 0, 7, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fit, err := fitLinear(tc.pts)
+			if err != nil {
+				t.Fatalf("fitLinear: %v", err)
+			}
+			if fit.N != len(tc.pts) || math.Abs(fit.Slope-tc.slope) > 1e-12 || math.Abs(fit.Intercept-tc.intercept) > 1e-12 ||
+				math.Abs(fit.R2-tc.r2) > 1e-12 {
+				t.Errorf("got %+v, want slope %g, intercept %g, R² %g", fit, tc.slope, tc.intercept, tc.r2)
+			}
+		})
+	}
+
+	for _, pts := range [][]point{nil, {{1, 1}}, {{2, 1}, {2, 3}}} {
+		if _, err := fitLinear(pts); err != errTooFewPoints {
+			t.Errorf("fitLinear(%v): got error %v, want %v", pts, err, errTooFewPoints)
+		}
+	}
+}
+
+func TestReadSeries(t *testing.T) {
+	in := "# count;seconds\n\n10;0.5;3;4\n 20 ; 1.5\n# comment\n30;2\n"
+	pts, err := readSeries(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("readSeries: %v", err)
+	}
+	if want := []point{{10, 0.5}, {20, 1.5}, {30, 2}}; !reflect.DeepEqual(pts, want) {
+		t.Errorf("got %v, want %v", pts, want)
+	}
+	for _, in := range []string{"10\n", "ten;1\n", "10;one\n"} {
+		if _, err := readSeries(strings.NewReader(in)); err == nil {
+			t.Errorf("readSeries(%q) returned no error", in)
+		}
+	}
+	if got := inRange(pts, 15, 30); !reflect.DeepEqual(got, pts[1:]) {
+		t.Errorf("inRange(15, 30) = %v, want %v", got, pts[1:])
+	}
+}
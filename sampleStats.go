@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// sampleSummary describes a series of measurements.
+type sampleSummary struct {
+	N      int     `json:"n"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// summarize returns the summary of the given values. The standard
+// deviation is the sample standard deviation.
+func summarize(values []float64) sampleSummary {
+	s := sampleSummary{N: len(values)}
+	if len(values) == 0 {
+		return s
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	s.Min, s.Max = sorted[0], sorted[len(sorted)-1]
+	s.Median = percentile(sorted, 0.5)
+	s.P95 = percentile(sorted, 0.95)
+	s.Mean = mean(values)
+	s.Stddev = stddev(values)
+	return s
+}
+
+// percentile returns the p-th percentile (0 <= p <= 1) of sorted values,
+// interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev returns the sample standard deviation of values.
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
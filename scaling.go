@@ -0,0 +1,374 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// modelFit is the least squares fit of a scaling model to walk results.
+type modelFit struct {
+	Model   string `json:"model"`
+	Formula string `json:"formula"`
+	// Coefficients in the order of the terms of Formula.
+	Coefficients []float64 `json:"coefficients"`
+	R2           float64   `json:"r2"`
+	// AdjustedR2 penalizes models with more coefficients, it is used to
+	// pick the best model.
+	AdjustedR2 float64 `json:"adjustedR2"`
+	// RMSE is the root mean square error in seconds.
+	RMSE float64 `json:"rmse"`
+
+	at func(float64) float64
+}
+
+// scalingModel describes how the duration of a walk may grow with the
+// number of entries.
+type scalingModel struct {
+	name    string
+	formula string
+	terms   []func(float64) float64
+}
+
+var scalingModels = []scalingModel{
+	{"linear", "a + b*n", []func(float64) float64{one, identity}},
+	{"nlogn", "a + b*n*log2(n)", []func(float64) float64{one, nLogN}},
+	{"quadratic", "a + b*n + c*n^2", []func(float64) float64{one, identity, square}},
+}
+
+func one(float64) float64        { return 1 }
+func identity(x float64) float64 { return x }
+func square(x float64) float64   { return x * x }
+
+func nLogN(x float64) float64 {
+	if x <= 1 {
+		return 0
+	}
+	return x * math.Log2(x)
+}
+
+// fitTerms returns the coefficients c minimizing the squared error of
+// y = sum(c[i] * terms[i](x)), solving the normal equations.
+func fitTerms(pts []point, terms []func(float64) float64) ([]float64, error) {
+	k := len(terms)
+	if len(pts) < k+1 {
+		return nil, errTooFewPoints
+	}
+	// Scale every column to at most 1, n^2 is huge compared to 1.
+	scale := make([]float64, k)
+	for _, p := range pts {
+		for j, t := range terms {
+			scale[j] = math.Max(scale[j], math.Abs(t(p.X)))
+		}
+	}
+	for j := range scale {
+		if scale[j] == 0 {
+			return nil, errTooFewPoints
+		}
+	}
+	// Augmented matrix [A^T A | A^T y].
+	m := make([][]float64, k)
+	for i := range m {
+		m[i] = make([]float64, k+1)
+	}
+	row := make([]float64, k)
+	for _, p := range pts {
+		for j, t := range terms {
+			row[j] = t(p.X) / scale[j]
+		}
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				m[i][j] += row[i] * row[j]
+			}
+			m[i][k] += row[i] * p.Y
+		}
+	}
+	coef, err := solveLinear(m)
+	if err != nil {
+		return nil, err
+	}
+	for j := range coef {
+		coef[j] /= scale[j]
+	}
+	return coef, nil
+}
+
+// solveLinear solves the k linear equations of the augmented k x k+1
+// matrix m by Gaussian elimination with partial pivoting. m is
+// overwritten.
+func solveLinear(m [][]float64) ([]float64, error) {
+	k := len(m)
+	for col := 0; col < k; col++ {
+		pivot := col
+		for r := col + 1; r < k; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, errTooFewPoints
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := col + 1; r < k; r++ {
+			f := m[r][col] / m[col][col]
+			for c := col; c <= k; c++ {
+				m[r][c] -= f * m[col][c]
+			}
+		}
+	}
+	x := make([]float64, k)
+	for i := k - 1; i >= 0; i-- {
+		sum := m[i][k]
+		for j := i + 1; j < k; j++ {
+			sum -= m[i][j] * x[j]
+		}
+		x[i] = sum / m[i][i]
+	}
+	return x, nil
+}
+
+// evalTerms returns the model given by terms and coefficients.
+func evalTerms(terms []func(float64) float64, coef []float64) func(float64) float64 {
+	return func(x float64) float64 {
+		y := 0.0
+		for j, t := range terms {
+			y += coef[j] * t(x)
+		}
+		return y
+	}
+}
+
+// sse returns the sum of squared errors of f for pts.
+func sse(pts []point, f func(float64) float64) float64 {
+	sum := 0.0
+	for _, p := range pts {
+		sum += (p.Y - f(p.X)) * (p.Y - f(p.X))
+	}
+	return sum
+}
+
+// fitModels fits all scaling models to pts. Models that cannot be fit
+// are left out.
+func fitModels(pts []point) []modelFit {
+	var fits []modelFit
+	n := float64(len(pts))
+	for _, m := range scalingModels {
+		coef, err := fitTerms(pts, m.terms)
+		if err != nil {
+			continue
+		}
+		f := evalTerms(m.terms, coef)
+		fit := modelFit{
+			Model:        m.name,
+			Formula:      m.formula,
+			Coefficients: coef,
+			R2:           rSquared(pts, f),
+			RMSE:         math.Sqrt(sse(pts, f) / n),
+			at:           f,
+		}
+		p := float64(len(coef) - 1)
+		fit.AdjustedR2 = 1 - (1-fit.R2)*(n-1)/(n-p-1)
+		fits = append(fits, fit)
+	}
+	return fits
+}
+
+// bestModel returns the index of the fit with the highest adjusted R²,
+// or -1 if there is none. A model with more coefficients than the linear
+// one only wins if it explains pts significantly better at level alpha,
+// so noise does not make a linear walk look quadratic.
+func bestModel(pts []point, fits []modelFit, alpha float64) int {
+	linear := -1
+	for i, f := range fits {
+		if f.Model == "linear" {
+			linear = i
+		}
+	}
+	best := -1
+	for i, f := range fits {
+		if best >= 0 && f.AdjustedR2 <= fits[best].AdjustedR2 {
+			continue
+		}
+		if linear >= 0 && len(f.Coefficients) > len(fits[linear].Coefficients) {
+			extra := float64(len(f.Coefficients) - len(fits[linear].Coefficients))
+			df2 := float64(len(pts) - len(f.Coefficients))
+			sseModel, sseLinear := sse(pts, f.at), sse(pts, fits[linear].at)
+			if df2 <= 0 || sseLinear == 0 {
+				continue
+			}
+			// A perfect fit of the model is infinitely better than the line.
+			F := math.Inf(1)
+			if sseModel > 0 {
+				F = ((sseLinear - sseModel) / extra) / (sseModel / df2)
+			}
+			if fSurvival(F, extra, df2) >= alpha {
+				continue
+			}
+		}
+		best = i
+	}
+	return best
+}
+
+// kinkFit is the best continuous two segment line through walk results,
+// y = a + b*n + c*max(0, n-Count). It locates where the duration departs
+// from the linear trend.
+type kinkFit struct {
+	// Count is the number of entries at which the slope changes.
+	Count       float64 `json:"count"`
+	SlopeBefore float64 `json:"slopeBefore"`
+	SlopeAfter  float64 `json:"slopeAfter"`
+	// F tests the two segments against a single line. PValue is the
+	// share of bootstrap samples of a single line with a larger F.
+	F           float64 `json:"f"`
+	PValue      float64 `json:"pValue"`
+	Significant bool    `json:"significant"`
+
+	at func(float64) float64
+}
+
+const (
+	// kinkMinPoints is the minimum number of points on both sides of a kink.
+	kinkMinPoints = 5
+	// kinkBootstrapSamples is the number of samples the p-value of a kink
+	// is estimated from.
+	kinkBootstrapSamples = 199
+)
+
+// detectKink searches the kink that explains pts best and tests it
+// against a single line at significance level alpha. It returns false
+// if there are too few points.
+//
+// The kink is placed where its F statistic is largest, so F does not
+// follow the F distribution of a single fixed kink and its p-value would
+// be far too small. Instead, the search is repeated on samples of the
+// fitted single line plus residuals drawn from its fit (a residual
+// bootstrap), and the p-value is the share of samples whose largest F
+// is at least as large as that of pts.
+func detectKink(pts []point, alpha float64) (kinkFit, bool) {
+	sorted := append([]point(nil), pts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+	if len(sorted) < 2*kinkMinPoints+1 {
+		return kinkFit{}, false
+	}
+	best, ok := searchKink(sorted)
+	if !ok {
+		return kinkFit{}, false
+	}
+
+	line, err := fitTerms(sorted, scalingModels[0].terms)
+	if err != nil {
+		return kinkFit{}, false
+	}
+	lineAt := evalTerms(scalingModels[0].terms, line)
+	residuals := make([]float64, len(sorted))
+	for i, p := range sorted {
+		residuals[i] = p.Y - lineAt(p.X)
+	}
+	// A fixed seed gives the same p-value for the same points.
+	rng := rand.New(rand.NewSource(1))
+	sample := make([]point, len(sorted))
+	larger := 0
+	for b := 0; b < kinkBootstrapSamples; b++ {
+		for i, p := range sorted {
+			sample[i] = point{X: p.X, Y: lineAt(p.X) + residuals[rng.Intn(len(residuals))]}
+		}
+		// A sample the search fails on counts against the kink.
+		if k, ok := searchKink(sample); !ok || k.F >= best.F {
+			larger++
+		}
+	}
+	best.PValue = float64(larger+1) / float64(kinkBootstrapSamples+1)
+	best.Significant = best.PValue < alpha
+	return best, true
+}
+
+// searchKink returns the kink with the largest F statistic against a
+// single line through pts, which must be sorted by X.
+func searchKink(pts []point) (kinkFit, bool) {
+	n := len(pts)
+	if pts[n-1].X == pts[0].X {
+		return kinkFit{}, false
+	}
+	// The kink with the smallest squared error is searched on centered
+	// and scaled points, using suffix sums of the points right of every
+	// kink. This takes O(n) instead of O(n^2) for a fit per kink.
+	var mx, my float64
+	for _, p := range pts {
+		mx += p.X
+		my += p.Y
+	}
+	mx /= float64(n)
+	my /= float64(n)
+	scale := pts[n-1].X - pts[0].X
+	x := make([]float64, n)
+	// Suffix sums of x, x^2, y and x*y from index i on.
+	sx, sxx, sy, sxy := make([]float64, n+1), make([]float64, n+1), make([]float64, n+1), make([]float64, n+1)
+	var syy float64
+	for i := n - 1; i >= 0; i-- {
+		x[i] = (pts[i].X - mx) / scale
+		y := pts[i].Y - my
+		sx[i] = sx[i+1] + x[i]
+		sxx[i] = sxx[i+1] + x[i]*x[i]
+		sy[i] = sy[i+1] + y
+		sxy[i] = sxy[i+1] + x[i]*y
+		syy += y * y
+	}
+	best := -1
+	bestSSE := math.Inf(1)
+	for i := kinkMinPoints; i < n-kinkMinPoints; i++ {
+		if pts[i].X == pts[i-1].X {
+			continue
+		}
+		// The kink term max(0, x-k) is x-k for the points from i on and 0
+		// before, the points are sorted.
+		k, right := x[i], float64(n-i)
+		sh := sx[i] - k*right
+		shh := sxx[i] - 2*k*sx[i] + k*k*right
+		sxh := sxx[i] - k*sx[i]
+		syh := sxy[i] - k*sy[i]
+		coef, err := solveLinear([][]float64{
+			{float64(n), sx[0], sh, sy[0]},
+			{sx[0], sxx[0], sxh, sxy[0]},
+			{sh, sxh, shh, syh},
+		})
+		if err != nil {
+			continue
+		}
+		if s := syy - coef[0]*sy[0] - coef[1]*sxy[0] - coef[2]*syh; s < bestSSE {
+			bestSSE = s
+			best = i
+		}
+	}
+	if best < 0 {
+		return kinkFit{}, false
+	}
+
+	// Fit the best kink again on the points as they are.
+	line, err := fitTerms(pts, scalingModels[0].terms)
+	if err != nil {
+		return kinkFit{}, false
+	}
+	sseLine := sse(pts, evalTerms(scalingModels[0].terms, line))
+	k := pts[best].X
+	terms := []func(float64) float64{one, identity, func(x float64) float64 { return math.Max(0, x-k) }}
+	coef, err := fitTerms(pts, terms)
+	if err != nil {
+		return kinkFit{}, false
+	}
+	f := evalTerms(terms, coef)
+	kink := kinkFit{Count: k, SlopeBefore: coef[1], SlopeAfter: coef[1] + coef[2], at: f}
+	sseKink := sse(pts, f)
+	// The kink adds two parameters, its position and the second slope.
+	df2 := float64(n - 4)
+	switch {
+	case sseLine == 0:
+		// A single line fits without error, there is no kink.
+		kink.F = 0
+	case sseKink == 0:
+		kink.F = math.Inf(1)
+	default:
+		kink.F = math.Max(0, ((sseLine-sseKink)/2)/(sseKink/df2))
+	}
+	return kink, true
+}
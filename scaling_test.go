@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBestModel(t *testing.T) {
+	series := func(xs []float64, f func(float64) float64) []point {
+		var pts []point
+		for _, x := range xs {
+			pts = append(pts, point{X: x, Y: f(x)})
+		}
+		return pts
+	}
+	tests := []struct {
+		name string
+		pts  []point
+		want string
+	}{
+		{"exact line", series([]float64{1, 2, 3, 4, 5, 6}, func(x float64) float64 { return 2 + 3*x }), "linear"},
+		// The quadratic model fits without any error, F is infinite.
+		{"exact parabola", series([]float64{0, 1, 2, 3, 4}, square), "quadratic"},
+		{"parabola", series([]float64{1, 2, 3, 4, 5, 6}, func(x float64) float64 { return 1 + x + 0.5*x*x }), "quadratic"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fits := fitModels(tc.pts)
+			i := bestModel(tc.pts, fits, 0.01)
+			if i < 0 {
+				t.Fatalf("no best model of %v", fits)
+			}
+			if got := fits[i].Model; got != tc.want {
+				t.Errorf("best model is %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectKink(t *testing.T) {
+	// walk returns 40 noisy durations of a walk taking 40µs per entry,
+	// 100µs per entry beyond kink entries if kink > 0.
+	walk := func(seed int64, kink float64) []point {
+		rng := rand.New(rand.NewSource(seed))
+		var pts []point
+		for i := 1; i <= 40; i++ {
+			x := float64(100 * i)
+			y := 0.01 + 4e-5*x + 0.005*rng.NormFloat64()
+			if kink > 0 {
+				y += 6e-5 * math.Max(0, x-kink)
+			}
+			pts = append(pts, point{X: x, Y: y})
+		}
+		return pts
+	}
+	for seed := int64(1); seed <= 10; seed++ {
+		if k, ok := detectKink(walk(seed, 0), 0.01); !ok || k.Significant {
+			t.Errorf("seed %d: linear walk with noise has a significant kink %+v", seed, k)
+		}
+		k, ok := detectKink(walk(seed, 2500), 0.01)
+		if !ok || !k.Significant {
+			t.Errorf("seed %d: kink at 2500 entries not found, got %+v", seed, k)
+		} else if k.Count < 2000 || k.Count > 3000 || math.Abs(k.SlopeAfter-1e-4) > 2e-5 {
+			t.Errorf("seed %d: kink at %g entries with slope %g after, want 2500 and 0.0001", seed, k.Count, k.SlopeAfter)
+		}
+	}
+
+	line := walk(1, 0)
+	for i := range line {
+		line[i].Y = 0.01 + 4e-5*line[i].X
+	}
+	if k, ok := detectKink(line, 0.01); !ok || k.Significant || k.PValue != 1 {
+		t.Errorf("exact line has a kink %+v", k)
+	}
+	if _, ok := detectKink(line[:2*kinkMinPoints], 0.01); ok {
+		t.Errorf("found a kink in %d points", 2*kinkMinPoints)
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+		tol  float64
+	}{
+		// Critical values of F and t tables.
+		{"F(1, 10) at 4.965", fSurvival(4.965, 1, 10), 0.05, 1e-4},
+		{"F(2, 20) at 3.493", fSurvival(3.493, 2, 20), 0.05, 1e-4},
+		{"F(5, 30) at 3.699", fSurvival(3.699, 5, 30), 0.01, 1e-4},
+		{"t(10) at 2.228", tTwoSided(2.228, 10), 0.05, 1e-4},
+		{"t(5) at -4.032", tTwoSided(-4.032, 5), 0.01, 1e-4},
+		{"t(30) at 2.042", tTwoSided(2.042, 30), 0.05, 1e-4},
+		// Closed forms: P(F > f) = (1 + 2f/d2)^(-d2/2) for d1 = 2,
+		// P(|T| > t) = 1 - t/sqrt(t^2 + 2) for 2 degrees of freedom and
+		// 1/2 at t = 1 for 1 degree of freedom.
+		{"F(2, 10) at 3", fSurvival(3, 2, 10), math.Pow(1.6, -5), 1e-12},
+		{"t(2) at 3", tTwoSided(3, 2), 1 - 3/math.Sqrt(11), 1e-12},
+		{"t(1) at 1", tTwoSided(1, 1), 0.5, 1e-12},
+		{"F at 0", fSurvival(0, 3, 7), 1, 0},
+		{"F at +Inf", fSurvival(math.Inf(1), 3, 7), 0, 0},
+		{"t at 0", tTwoSided(0, 7), 1, 0},
+	}
+	for _, tc := range tests {
+		if math.Abs(tc.got-tc.want) > tc.tol {
+			t.Errorf("%s: got %.6g, want %.6g", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestFitModels(t *testing.T) {
+	var pts []point
+	for x := 1.0; x <= 64; x *= 2 {
+		pts = append(pts, point{X: x, Y: 3 + 2*x + 0.5*x*x})
+	}
+	want := map[string][]float64{
+		"quadratic": {3, 2, 0.5},
+	}
+	fits := fitModels(pts)
+	if len(fits) != len(scalingModels) {
+		t.Fatalf("got %d fits, want %d", len(fits), len(scalingModels))
+	}
+	for _, f := range fits {
+		if f.Model == "linear" {
+			line, err := fitLinear(pts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want["linear"] = []float64{line.Intercept, line.Slope}
+			if math.Abs(f.R2-line.R2) > 1e-9 {
+				t.Errorf("linear model has R² %g, fitLinear %g", f.R2, line.R2)
+			}
+		}
+	}
+	for _, f := range fits {
+		coef, ok := want[f.Model]
+		if !ok {
+			continue
+		}
+		for i := range coef {
+			if math.Abs(f.Coefficients[i]-coef[i]) > 1e-9*math.Max(1, math.Abs(coef[i])) {
+				t.Errorf("%s: got coefficients %v, want %v", f.Model, f.Coefficients, coef)
+				break
+			}
+		}
+	}
+	if best := bestModel(pts, fits, 0.01); best < 0 || fits[best].Model != "quadratic" || math.Abs(fits[best].R2-1) > 1e-12 {
+		t.Errorf("best model is %d of %+v, want the exact quadratic fit", best, fits)
+	}
+}
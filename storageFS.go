@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// walkFS is the filesystem below xlStorage. Paths are absolute. Errors
+// are *os.PathError holding a syscall.Errno, the way the os package
+// returns them, so the checks in errors.go work for all implementations.
+type walkFS interface {
+	// ReadDir returns up to count entries of a directory, all entries if
+	// count is -1. Directories have a trailing slash. It returns
+	// errFileNotFound if dirPath does not exist or is not a directory.
+	ReadDir(dirPath string, count int) ([]string, error)
+	// Open opens a file for reading.
+	Open(filePath string) (walkFile, error)
+	// ReadFile reads a whole file.
+	ReadFile(filePath string) ([]byte, error)
+	// Lstat returns the file info without following symlinks.
+	Lstat(name string) (os.FileInfo, error)
+	// Access checks that name exists and is readable and writable.
+	Access(name string) error
+}
+
+// walkFile is a file opened by a walkFS.
+type walkFile interface {
+	io.Reader
+	Stat() (os.FileInfo, error)
+	Close() error
+}
+
+// osFS is the real filesystem, accessed the way MinIO does: getdents for
+// directories, O_NOATIME for xl.meta and O_DIRECT for xl.json.
+type osFS struct {
+	// stats records the time spent in Stat fallbacks of ReadDir, if set.
+	stats *walkStats
+}
+
+func (f osFS) ReadDir(dirPath string, count int) ([]string, error) {
+	return readDirWithOpts(dirPath, readDirOpts{count: count, stats: f.stats})
+}
+
+func (osFS) Open(filePath string) (walkFile, error) {
+	f, err := os.OpenFile(filePath, readMode, 0)
+	if err != nil {
+		// Do not return a nil *os.File as non-nil walkFile.
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) ReadFile(filePath string) ([]byte, error) {
+	return ReadFile(filePath)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) Access(name string) error {
+	return Access(name)
+}
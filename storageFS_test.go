@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemFSMatchesOSFS(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		dir := t.TempDir()
+		if _, err := generateBucket(osGenFS{}, filepath.Join(dir, "bkt"), tc.cfg); err != nil {
+			t.Fatalf("generateBucket: %v", err)
+		}
+		loaded, err := loadMemFS(dir)
+		if err != nil {
+			t.Fatalf("loadMemFS: %v", err)
+		}
+		generated, _ := newGenStorage(t, tc.cfg, 0)
+		storages := []struct {
+			name string
+			s    *xlStorage
+		}{
+			{"osFS", &xlStorage{diskPath: dir}},
+			{"loaded memFS", &xlStorage{diskPath: dir, fs: loaded}},
+			{"generated memFS", generated},
+		}
+
+		walk := func(s *xlStorage, opts WalkDirOptions) ([]metaCacheEntry, walkResult) {
+			opts.Bucket = "bkt"
+			var entries []metaCacheEntry
+			res, err := s.WalkDir(context.Background(), opts, func(e metaCacheEntry) {
+				entries = append(entries, e)
+			})
+			if err != nil {
+				t.Fatalf("WalkDir: %v", err)
+			}
+			return entries, res
+		}
+		optss := []WalkDirOptions{{Recursive: true}, {}}
+		if tc.cfg.Fanout > 1 {
+			optss = append(optss, WalkDirOptions{BaseDir: "dir00001/", Recursive: true})
+		}
+		for _, opts := range optss {
+			want, wantRes := walk(storages[0].s, opts)
+			if len(want) == 0 || len(wantRes.Errors) > 0 {
+				t.Fatalf("%s: osFS walk sent %d entries, errors %v", tc.name, len(want), wantRes.Errors)
+			}
+			for _, st := range storages[1:] {
+				t.Run(fmt.Sprintf("%s/%s/recursive=%v/base-dir=%q", tc.name, st.name, opts.Recursive, opts.BaseDir), func(t *testing.T) {
+					got, res := walk(st.s, opts)
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("sent %d entries that differ from the %d on osFS", len(got), len(want))
+					}
+					if !reflect.DeepEqual(res, wantRes) {
+						t.Errorf("returned %+v, on osFS %+v", res, wantRes)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+)
+
+// chartSeries is a series of points drawn in a chart.
+type chartSeries struct {
+	Name   string
+	Points []point
+	// Markers draws a marker on every point, like gnuplot's linespoints.
+	Markers bool
+	// Dashed draws a dashed line, used for fitted models.
+	Dashed bool
+}
+
+// chart is a line chart rendered as SVG, replacing plot.plt.
+type chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Series []chartSeries
+}
+
+const (
+	chartWidth   = 960
+	chartHeight  = 600
+	chartLeft    = 80
+	chartRight   = 30
+	chartTop     = 50
+	chartBottom  = 60
+	chartNumTick = 10
+)
+
+// chartColors are the colors of the series, in order.
+var chartColors = []string{"#9400d3", "#009e73", "#56b4e9", "#e69f00", "#f0e442", "#0072b2", "#e51e10"}
+
+// niceTicks returns about n evenly spaced round values covering
+// [min, max], and the number of decimals needed to print them.
+func niceTicks(min, max float64, n int) ([]float64, int) {
+	if max <= min {
+		max = min + 1
+	}
+	raw := (max - min) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*mag >= raw {
+			step = m * mag
+			break
+		}
+	}
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	var ticks []float64
+	for v := math.Floor(min/step) * step; v <= max+step/2; v += step {
+		ticks = append(ticks, v)
+	}
+	return ticks, decimals
+}
+
+// writeSVG renders the chart. The axes start at the smallest tick below
+// the data, the way gnuplot autoscales them.
+func (c chart) writeSVG(w io.Writer) error {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		minX, maxX, minY, maxY = 0, 1, 0, 1
+	}
+	xTicks, xDec := niceTicks(minX, maxX, chartNumTick)
+	yTicks, yDec := niceTicks(math.Min(minY, 0), maxY, chartNumTick)
+	x0, x1 := xTicks[0], xTicks[len(xTicks)-1]
+	y0, y1 := yTicks[0], yTicks[len(yTicks)-1]
+
+	plotW := float64(chartWidth - chartLeft - chartRight)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	px := func(x float64) float64 { return chartLeft + (x-x0)/(x1-x0)*plotW }
+	py := func(y float64) float64 { return chartTop + plotH - (y-y0)/(y1-y0)*plotH }
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	if c.Title != "" {
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle" font-size="16">%s</text>`+"\n",
+			chartWidth/2, chartTop/2+5, html.EscapeString(c.Title))
+	}
+
+	// Grid and tick labels.
+	for _, t := range xTicks {
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="grey" stroke-width="0.5"/>`+"\n",
+			px(t), chartTop, px(t), chartTop+plotH)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" text-anchor="middle">%.*f</text>`+"\n",
+			px(t), chartTop+plotH+18, xDec, t)
+	}
+	for _, t := range yTicks {
+		fmt.Fprintf(bw, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="grey" stroke-width="0.5"/>`+"\n",
+			chartLeft, py(t), chartLeft+plotW, py(t))
+		fmt.Fprintf(bw, `<text x="%d" y="%.1f" text-anchor="end">%.*f</text>`+"\n",
+			chartLeft-6, py(t)+4, yDec, t)
+	}
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="black"/>`+"\n",
+		chartLeft, chartTop, plotW, plotH)
+	fmt.Fprintf(bw, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+		chartLeft+plotW/2, chartHeight-15, html.EscapeString(c.XLabel))
+	fmt.Fprintf(bw, `<text x="20" y="%.1f" text-anchor="middle" transform="rotate(-90 20 %.1f)">%s</text>`+"\n",
+		chartTop+plotH/2, chartTop+plotH/2, html.EscapeString(c.YLabel))
+
+	// Series and legend.
+	for i, s := range c.Series {
+		color := chartColors[i%len(chartColors)]
+		dash := ""
+		if s.Dashed {
+			dash = ` stroke-dasharray="6 4"`
+		}
+		fmt.Fprintf(bw, `<polyline fill="none" stroke="%s" stroke-width="1.5"%s points="`, color, dash)
+		for _, p := range s.Points {
+			fmt.Fprintf(bw, "%.1f,%.1f ", px(p.X), py(p.Y))
+		}
+		fmt.Fprintf(bw, "\"/>\n")
+		if s.Markers {
+			for _, p := range s.Points {
+				fmt.Fprintf(bw, `<circle cx="%.1f" cy="%.1f" r="2" fill="none" stroke="%s"/>`+"\n", px(p.X), py(p.Y), color)
+			}
+		}
+		ly := float64(chartTop + 20 + 18*i)
+		fmt.Fprintf(bw, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" stroke-width="1.5"%s/>`+"\n",
+			chartLeft+15, ly, chartLeft+45, ly, color, dash)
+		fmt.Fprintf(bw, `<text x="%d" y="%.1f">%s</text>`+"\n", chartLeft+52, ly+4, html.EscapeString(s.Name))
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chromeEvent is an event of the Chrome Trace Event format, which
+// chrome://tracing and Perfetto open.
+type chromeEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	// Ph is the phase, X for a complete span, M for metadata, s and f for
+	// the start and end of a flow.
+	Ph string `json:"ph"`
+	// Ts and Dur are in microseconds.
+	Ts   float64           `json:"ts"`
+	Dur  float64           `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  int64             `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+	// ID links the start and end of a flow.
+	ID int64 `json:"id,omitempty"`
+}
+
+// timeline records the spans of a walk for the Chrome Trace Event
+// format. Every track is a thread of the trace, spans on the same track
+// nest by time. Each goroutine of a walk takes its own track with
+// newTrack and passes its ID along. Work handed to another goroutine is
+// linked to the span it was started from by a flow. A nil *timeline
+// records nothing. It is safe for concurrent use.
+type timeline struct {
+	root  string
+	start time.Time
+	// tracks is the last track ID handed out.
+	tracks int64
+	// flows is the last flow ID handed out.
+	flows int64
+
+	mu     sync.Mutex
+	events []chromeEvent
+	tids   map[int64]bool
+}
+
+func newTimeline(root string) *timeline {
+	return &timeline{root: root, start: time.Now(), tids: make(map[int64]bool)}
+}
+
+// newTrack returns the ID of a new track, starting at 1.
+func (t *timeline) newTrack() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.AddInt64(&t.tracks, 1)
+}
+
+// span records a span of name on path that started at start and ends
+// now, on track tid. It is meant to be deferred:
+// defer s.timeline.span(tid, "ListDir", dirPath, time.Now())
+func (t *timeline) span(tid int64, name, path string, start time.Time) {
+	if t == nil {
+		return
+	}
+	end := time.Now()
+	cat := "fs"
+	if name == "scanDir" || name == "probe" {
+		cat = "walk"
+	}
+	if t.root != "" {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, t.root), SlashSeparator)
+	}
+	t.add(chromeEvent{
+		Name: name,
+		Cat:  cat,
+		Ph:   "X",
+		Ts:   t.since(start),
+		Dur:  float64(end.Sub(start).Nanoseconds()) / 1e3,
+		Pid:  1,
+		Tid:  tid,
+		Args: map[string]string{"path": path},
+	})
+}
+
+// flowStart records the start of a flow of name on track tid, at the
+// span that is running on the track now. It returns the ID to pass to
+// flowEnd on the track the work continues on.
+func (t *timeline) flowStart(tid int64, name string) int64 {
+	if t == nil {
+		return 0
+	}
+	id := atomic.AddInt64(&t.flows, 1)
+	t.add(chromeEvent{Name: name, Cat: "walk", Ph: "s", Ts: t.since(time.Now()), Pid: 1, Tid: tid, ID: id})
+	return id
+}
+
+// flowEnd records the end of flow id on track tid. The flow ends at the
+// next span that starts on the track, so flowEnd is called right before
+// the span is started.
+func (t *timeline) flowEnd(tid int64, name string, id int64) {
+	if t == nil {
+		return
+	}
+	t.add(chromeEvent{Name: name, Cat: "walk", Ph: "f", Ts: t.since(time.Now()), Pid: 1, Tid: tid, ID: id})
+}
+
+// since returns the timestamp of at in the trace.
+func (t *timeline) since(at time.Time) float64 {
+	return float64(at.Sub(t.start).Nanoseconds()) / 1e3
+}
+
+func (t *timeline) add(ev chromeEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, ev)
+	t.tids[ev.Tid] = true
+}
+
+// writeFile writes the timeline as Chrome Trace Event JSON.
+func (t *timeline) writeFile(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := make([]chromeEvent, 0, len(t.events)+len(t.tids)+1)
+	events = append(events, chromeEvent{Name: "process_name", Ph: "M", Pid: 1, Args: map[string]string{"name": "walkdir"}})
+	tids := make([]int64, 0, len(t.tids))
+	for tid := range t.tids {
+		tids = append(tids, tid)
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+	for _, tid := range tids {
+		events = append(events, chromeEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: tid,
+			Args: map[string]string{"name": "track " + strconv.FormatInt(tid, 10)}})
+	}
+	events = append(events, t.events...)
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{events, "ms"})
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestTimelineNesting checks that every span of a concurrent walk
+// traces back to the scanDir of the bucket: spans nest by time on their
+// track, and the outermost span of every other track is the end of a
+// flow started in the scanDir of its parent directory.
+func TestTimelineNesting(t *testing.T) {
+	cfg := genConfig{Depth: 2, Fanout: 3, FilesPerDir: 20, DirObjectRatio: 0.1, Seed: 7}
+	s, _ := newGenStorage(t, cfg, 4)
+	s.timeline = newTimeline(s.diskPath)
+	walkNames(t, s, WalkDirOptions{})
+	name := filepath.Join(t.TempDir(), "walk.json")
+	if err := s.timeline.writeFile(name); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf, &trace); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[int64][]chromeEvent)
+	flowStarts := make(map[int64]chromeEvent)
+	var flowEnds []chromeEvent
+	for _, ev := range trace.TraceEvents {
+		switch ev.Ph {
+		case "X":
+			spans[ev.Tid] = append(spans[ev.Tid], ev)
+		case "s":
+			flowStarts[ev.ID] = ev
+		case "f":
+			flowEnds = append(flowEnds, ev)
+		}
+	}
+	for _, track := range spans {
+		// Parents first.
+		sort.Slice(track, func(i, j int) bool {
+			if track[i].Ts != track[j].Ts {
+				return track[i].Ts < track[j].Ts
+			}
+			return track[i].Dur > track[j].Dur
+		})
+	}
+	// dir returns the path of a scanDir or probe span, without the
+	// trailing slash of directories below the bucket.
+	dir := func(span chromeEvent) string {
+		return strings.TrimSuffix(span.Args["path"], SlashSeparator)
+	}
+	contains := func(span chromeEvent, ts float64) bool {
+		return span.Ts <= ts && ts <= span.Ts+span.Dur
+	}
+	// innermost returns the innermost span of name on track tid that was
+	// running at ts.
+	innermost := func(tid int64, name string, ts float64) (chromeEvent, bool) {
+		var found chromeEvent
+		var ok bool
+		for _, span := range spans[tid] {
+			if span.Name == name && contains(span, ts) {
+				found, ok = span, true
+			}
+		}
+		return found, ok
+	}
+
+	// The walk runs on track 1, in the scanDir of the bucket.
+	roots := make(map[int64]int)
+	for tid, track := range spans {
+		for i, span := range track {
+			outer := true
+			for _, parent := range track[:i] {
+				if contains(parent, span.Ts) {
+					if !contains(parent, span.Ts+span.Dur) {
+						t.Errorf("track %d: %s %q overlaps %s %q", tid, span.Name, span.Args["path"], parent.Name, parent.Args["path"])
+					}
+					outer = false
+				}
+			}
+			if outer {
+				roots[tid]++
+			}
+		}
+	}
+	if roots[1] != 1 || spans[1][0].Name != "scanDir" || spans[1][0].Args["path"] != "bkt" {
+		t.Fatalf("track 1 starts with %s %q and has %d outermost spans", spans[1][0].Name, spans[1][0].Args["path"], roots[1])
+	}
+
+	linked := make(map[int64]bool)
+	var probes, scans int
+	for _, end := range flowEnds {
+		start, ok := flowStarts[end.ID]
+		if !ok || start.Name != end.Name {
+			t.Errorf("flow %d ends with %s without a start", end.ID, end.Name)
+			continue
+		}
+		parent, ok := innermost(start.Tid, "scanDir", start.Ts)
+		if !ok {
+			t.Errorf("flow %d starts outside a scanDir on track %d", end.ID, start.Tid)
+			continue
+		}
+		// The flow ends at the next span of its track, which has to be
+		// its only outermost span.
+		track := spans[end.Tid]
+		if len(track) == 0 || track[0].Ts < end.Ts || track[0].Name != end.Name || roots[end.Tid] != 1 {
+			t.Errorf("flow %d does not end at the only outermost span of track %d", end.ID, end.Tid)
+			continue
+		}
+		child, from := dir(track[0]), dir(parent)
+		switch end.Name {
+		case "probe":
+			probes++
+			if child != from {
+				t.Errorf("probe of %q started from scanDir of %q", child, from)
+			}
+		case "scanDir":
+			scans++
+			if !strings.HasPrefix(child, from+SlashSeparator) {
+				t.Errorf("scanDir of %q started from scanDir of %q", child, from)
+			}
+		}
+		linked[end.Tid] = true
+	}
+	for tid, track := range spans {
+		if tid != 1 && !linked[tid] {
+			t.Errorf("track %d starting with %s %q is not linked by a flow", tid, track[0].Name, track[0].Args["path"])
+		}
+		for _, span := range track {
+			if span.Name != "readMetadata" {
+				continue
+			}
+			// The metadata of an entry is read in the scanDir of its
+			// directory, or ahead by a worker probing the directory.
+			want := strings.TrimSuffix(span.Args["path"], SlashSeparator+xlStorageFormatFile)
+			want = want[:strings.LastIndex(want, SlashSeparator)]
+			if parent, ok := innermost(tid, "scanDir", span.Ts); ok && dir(parent) == want {
+				continue
+			}
+			if probe, ok := innermost(tid, "probe", span.Ts); !ok || dir(probe) != want {
+				t.Errorf("track %d: readMetadata of %q is not nested in the scanDir or probe of %q", tid, span.Args["path"], want)
+			}
+		}
+	}
+	if probes == 0 || scans == 0 {
+		t.Errorf("got %d probes and %d background scans, want both", probes, scans)
+	}
+}
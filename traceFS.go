@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// traceEvent is a filesystem call recorded by a traceFS, one JSON
+// object per line of the trace.
+type traceEvent struct {
+	// T is the start of the call in nanoseconds since the trace started,
+	// measured with the monotonic clock.
+	T  int64  `json:"t"`
+	Op string `json:"op"`
+	// Path is relative to the root of the traced filesystem, so the trace
+	// can be replayed against another mount.
+	Path string `json:"path"`
+	// FD identifies the file of open, read, stat and close calls.
+	FD int64 `json:"fd,omitempty"`
+	// Count is the maximum number of entries of a readdir, Len the buffer
+	// size of a read.
+	Count int `json:"count,omitempty"`
+	Len   int `json:"len,omitempty"`
+	// Dur is the duration of the call in nanoseconds.
+	Dur int64 `json:"dur"`
+	// Size is the number of entries of a readdir, the bytes returned by
+	// a read or readfile and the file size of a stat or lstat.
+	Size  int64  `json:"size"`
+	Errno string `json:"errno,omitempty"`
+	Err   string `json:"err,omitempty"`
+}
+
+// errnoName returns the name of the errno behind err, like ENOENT, or ""
+// if there is none. The errors of ReadDir, which are already mapped by
+// osErrToFileErr, are mapped back.
+func errnoName(err error) string {
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &errno):
+		return unix.ErrnoName(errno)
+	case err == errFileNotFound:
+		return "ENOENT"
+	case err == errTooManyOpenFiles:
+		return "EMFILE"
+	case err == errFaultyDisk:
+		return "EIO"
+	case err == errFileAccessDenied:
+		return "EACCES"
+	case err == io.EOF:
+		return "EOF"
+	}
+	return ""
+}
+
+// tracer writes trace events as JSON lines. It is safe for concurrent
+// use.
+type tracer struct {
+	mu    sync.Mutex
+	start time.Time
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	fd    int64
+	err   error
+}
+
+func newTracer(name string) (*tracer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &tracer{start: time.Now(), f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// nextFD returns a new file ID.
+func (t *tracer) nextFD() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fd++
+	return t.fd
+}
+
+// record writes the event of a call that started at start and failed
+// with err, if not nil.
+func (t *tracer) record(ev traceEvent, start time.Time, err error) {
+	ev.T = int64(start.Sub(t.start))
+	ev.Dur = int64(time.Since(start))
+	if err != nil {
+		ev.Errno = errnoName(err)
+		ev.Err = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = t.enc.Encode(ev)
+	}
+}
+
+// Close flushes and closes the trace and returns the first write error.
+func (t *tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.w.Flush(); t.err == nil {
+		t.err = err
+	}
+	if err := t.f.Close(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+// traceFS records every call to another walkFS.
+type traceFS struct {
+	fs   walkFS
+	root string
+	t    *tracer
+}
+
+func newTraceFS(fs walkFS, root string, t *tracer) *traceFS {
+	return &traceFS{fs: fs, root: root, t: t}
+}
+
+// rel returns name relative to the root of the traceFS.
+func (f *traceFS) rel(name string) string {
+	if f.root == "" {
+		return name
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, f.root), SlashSeparator)
+}
+
+func (f *traceFS) ReadDir(dirPath string, count int) ([]string, error) {
+	start := time.Now()
+	entries, err := f.fs.ReadDir(dirPath, count)
+	f.t.record(traceEvent{Op: "readdir", Path: f.rel(dirPath), Count: count, Size: int64(len(entries))}, start, err)
+	return entries, err
+}
+
+func (f *traceFS) Open(filePath string) (walkFile, error) {
+	start := time.Now()
+	file, err := f.fs.Open(filePath)
+	ev := traceEvent{Op: "open", Path: f.rel(filePath)}
+	if err == nil {
+		ev.FD = f.t.nextFD()
+	}
+	f.t.record(ev, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &traceFile{walkFile: file, t: f.t, path: ev.Path, fd: ev.FD}, nil
+}
+
+func (f *traceFS) ReadFile(filePath string) ([]byte, error) {
+	start := time.Now()
+	data, err := f.fs.ReadFile(filePath)
+	f.t.record(traceEvent{Op: "readfile", Path: f.rel(filePath), Size: int64(len(data))}, start, err)
+	return data, err
+}
+
+func (f *traceFS) Lstat(name string) (os.FileInfo, error) {
+	start := time.Now()
+	fi, err := f.fs.Lstat(name)
+	ev := traceEvent{Op: "lstat", Path: f.rel(name)}
+	if err == nil {
+		ev.Size = fi.Size()
+	}
+	f.t.record(ev, start, err)
+	return fi, err
+}
+
+func (f *traceFS) Access(name string) error {
+	start := time.Now()
+	err := f.fs.Access(name)
+	f.t.record(traceEvent{Op: "access", Path: f.rel(name)}, start, err)
+	return err
+}
+
+// traceFile records the calls on a file opened by a traceFS.
+type traceFile struct {
+	walkFile
+	t    *tracer
+	path string
+	fd   int64
+}
+
+func (f *traceFile) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := f.walkFile.Read(p)
+	f.t.record(traceEvent{Op: "read", Path: f.path, FD: f.fd, Len: len(p), Size: int64(n)}, start, err)
+	return n, err
+}
+
+func (f *traceFile) Stat() (os.FileInfo, error) {
+	start := time.Now()
+	fi, err := f.walkFile.Stat()
+	ev := traceEvent{Op: "stat", Path: f.path, FD: f.fd}
+	if err == nil {
+		ev.Size = fi.Size()
+	}
+	f.t.record(ev, start, err)
+	return fi, err
+}
+
+func (f *traceFile) Close() error {
+	start := time.Now()
+	err := f.walkFile.Close()
+	f.t.record(traceEvent{Op: "close", Path: f.path, FD: f.fd}, start, err)
+	return err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// traceWalk walks the bucket of s through a traceFS and returns the
+// recorded events.
+func traceWalk(t *testing.T, s *xlStorage) []traceEvent {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "trace.jsonl")
+	tr, err := newTracer(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := s.fs
+	s.fs = newTraceFS(fs, s.diskPath, tr)
+	defer func() { s.fs = fs }()
+	walkNames(t, s, WalkDirOptions{})
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events, err := readTrace(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// traceCalls returns the op and path of every event, and the ops and
+// paths of the calls on each file in the order of the file's open.
+func traceCalls(events []traceEvent) (calls []string, files [][]string) {
+	fds := make(map[int64]int)
+	for _, ev := range events {
+		call := ev.Op + " " + ev.Path
+		calls = append(calls, call)
+		if ev.FD == 0 {
+			continue
+		}
+		i, ok := fds[ev.FD]
+		if !ok {
+			i = len(files)
+			fds[ev.FD] = i
+			files = append(files, nil)
+		}
+		files[i] = append(files[i], call)
+	}
+	return calls, files
+}
+
+// sortFiles sorts the calls on files of traceCalls by their calls.
+func sortFiles(files [][]string) {
+	sort.Slice(files, func(i, j int) bool { return strings.Join(files[i], "\n") < strings.Join(files[j], "\n") })
+}
+
+// TestTraceReplay records a walk and replays the trace against the same
+// tree through another traceFS, which has to record the same calls.
+func TestTraceReplay(t *testing.T) {
+	cfg := genConfig{Depth: 2, Fanout: 3, FilesPerDir: 10, DirObjectRatio: 0.1, LegacyRatio: 0.2, Seed: 8}
+	for _, concurrency := range []int{0, 4} {
+		for _, timing := range []bool{false, true} {
+			t.Run(fmt.Sprintf("concurrency=%d/timing=%v", concurrency, timing), func(t *testing.T) {
+				s, _ := newGenStorage(t, cfg, concurrency)
+				recorded := traceWalk(t, s)
+				calls, files := traceCalls(recorded)
+				if len(files) == 0 {
+					t.Fatal("the walk opened no files")
+				}
+
+				name := filepath.Join(t.TempDir(), "replay.jsonl")
+				tr, err := newTracer(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rep := replay(newTraceFS(s.fs, s.diskPath, tr), s.diskPath, recorded, timing)
+				if err := tr.Close(); err != nil {
+					t.Fatal(err)
+				}
+				replayed, err := readTrace(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotCalls, gotFiles := traceCalls(replayed)
+
+				// Calls issued one after another are issued in the recorded
+				// order. Calls on the same file always are.
+				if !timing && !reflect.DeepEqual(gotCalls, calls) {
+					t.Errorf("replayed calls\n%v\nrecorded\n%v", gotCalls, calls)
+				}
+				if len(gotCalls) != len(calls) {
+					t.Errorf("replayed %d calls, recorded %d", len(gotCalls), len(calls))
+				}
+				if timing {
+					// Files are opened in any order.
+					sortFiles(gotFiles)
+					sortFiles(files)
+				}
+				if !reflect.DeepEqual(gotFiles, files) {
+					t.Errorf("replayed calls on files\n%v\nrecorded\n%v", gotFiles, files)
+				}
+				// The walk looks for files that do not exist, and has to
+				// fail on them again.
+				errors := make(map[string]int)
+				for _, ev := range recorded {
+					if ev.Err != "" && ev.Errno != "EOF" {
+						errors[ev.Op]++
+					}
+				}
+				total := 0
+				for _, st := range rep.Ops {
+					total += st.Calls
+					if st.Errors != errors[st.Op] || st.Mismatches > 0 || st.Skipped > 0 {
+						t.Errorf("%s: %d errors, %d recorded, %d mismatches, %d skipped", st.Op, st.Errors, errors[st.Op],
+							st.Mismatches, st.Skipped)
+					}
+				}
+				if total != len(recorded) {
+					t.Errorf("report counts %d calls, recorded %d", total, len(recorded))
+				}
+			})
+		}
+	}
+}
@@ -100,3 +100,11 @@ func checkPathLength(pathName string) error {
 	} // Success.
 	return nil
 }
+
+// decodeDirObject - decodes encoded directory object name.
+func decodeDirObject(object string) string {
+	if HasSuffix(object, globalDirSuffix) {
+		return strings.TrimSuffix(object, globalDirSuffix) + SlashSeparator
+	}
+	return object
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of entries a concurrent directory scan may produce before it
+// has to wait for its parent to collect them.
+const walkStreamBuffer = 256
+
+// Largest number of entries of a directory whose metadata is read ahead
+// at once.
+const probeWindowMax = 1024
+
+// walkPool limits the number of filesystem calls a concurrent WalkDir
+// runs at the same time. A nil *walkPool runs everything synchronously.
+//
+// Slots are only held for the duration of a single filesystem call and
+// never while waiting on the output of another scan, so scans blocked
+// on their parent can never starve the pool.
+//
+// At most the pool size of directory scans run in the background, so a
+// walk that is stopped early, e.g. after the first page, does not scan
+// far ahead of the directory it sends.
+type walkPool struct {
+	sem chan struct{}
+	// scans holds a slot for every scan started with goScan that has not
+	// returned yet.
+	scans chan struct{}
+	wg    sync.WaitGroup
+	// timeline hands out the tracks of the goroutines of the pool.
+	timeline *timeline
+}
+
+func newWalkPool(size int, timeline *timeline) *walkPool {
+	return &walkPool{sem: make(chan struct{}, size), scans: make(chan struct{}, size), timeline: timeline}
+}
+
+// do runs fn as soon as a slot in the pool is free.
+func (p *walkPool) do(fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+	fn()
+}
+
+// forEach calls fn for every index in [0, n) using up to the pool size
+// in parallel and returns when all calls have returned. Every worker
+// passes the ID of its own track to fn and records a span of name on
+// path there, linked by a flow to the span running on track tid.
+func (p *walkPool) forEach(tid int64, name, path string, n int, fn func(tid int64, i int)) {
+	workers := cap(p.sem)
+	if workers > n {
+		workers = n
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		flow := p.timeline.flowStart(tid, name)
+		tid := p.timeline.newTrack()
+		go func() {
+			defer wg.Done()
+			p.timeline.flowEnd(tid, name, flow)
+			defer p.timeline.span(tid, name, path, time.Now())
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				p.do(func() { fn(tid, i) })
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// nextWindow returns the number of entries to read the metadata of
+// ahead, given the previous window: the pool size at first, then twice
+// the previous window up to probeWindowMax.
+func (p *walkPool) nextWindow(prev int) int {
+	if prev == 0 {
+		return cap(p.sem)
+	}
+	if prev*2 > probeWindowMax {
+		return probeWindowMax
+	}
+	return prev * 2
+}
+
+// wait blocks until all scans started with goScan have returned.
+func (p *walkPool) wait() {
+	p.wg.Wait()
+}
+
+// walkStream is the ordered output of a directory scan running in its
+// own goroutine.
+type walkStream struct {
+	ch chan metaCacheEntry
+	// err is the result of the scan. Only valid once ch is closed.
+	err error
+}
+
+// goScan runs scan for dir in a new goroutine on a track of its own,
+// linked by a flow to the span running on track tid.
+// The entries it sends can be collected in order with drain. The scan
+// gives up sending when ctx is canceled, so a stream that is never
+// drained does not leak as long as ctx is canceled eventually.
+//
+// goScan returns nil without starting a scan if the pool size of scans
+// is already running. It never waits for one to return, the caller
+// scans dir itself once it needs its output instead.
+func (p *walkPool) goScan(ctx context.Context, tid int64, dir string, scan func(int64, string, func(metaCacheEntry) error) error) *walkStream {
+	select {
+	case p.scans <- struct{}{}:
+	default:
+		return nil
+	}
+	st := &walkStream{ch: make(chan metaCacheEntry, walkStreamBuffer)}
+	flow := p.timeline.flowStart(tid, "scanDir")
+	tid = p.timeline.newTrack()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.scans }()
+		// Always close, the collector ranges over the channel.
+		defer close(st.ch)
+		p.timeline.flowEnd(tid, "scanDir", flow)
+		st.err = scan(tid, dir, func(entry metaCacheEntry) error {
+			select {
+			case st.ch <- entry:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return st
+}
+
+// drain passes all entries of the stream to send in the order they
+// were produced and returns once the scan is done.
+func (st *walkStream) drain(send func(metaCacheEntry) error) error {
+	for entry := range st.ch {
+		if err := send(entry); err != nil {
+			// The scan stops on its own once the context is canceled.
+			return err
+		}
+	}
+	return st.err
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWalkConcurrentMatchesSequential(t *testing.T) {
+	for _, tc := range genTestConfigs {
+		s, _ := newGenStorage(t, tc.cfg, 0)
+		want, wantRes := walkNames(t, s, WalkDirOptions{})
+		if !sort.StringsAreSorted(want) {
+			t.Errorf("%s: sequential walk is not sorted: %v", tc.name, want)
+		}
+		for _, concurrency := range []int{2, 3, 8, 64} {
+			t.Run(fmt.Sprintf("%s/concurrency=%d", tc.name, concurrency), func(t *testing.T) {
+				s.walkConcurrency = concurrency
+				got, res := walkNames(t, s, WalkDirOptions{})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("concurrent walk sent\n%v\nsequential walk sent\n%v", got, want)
+				}
+				if !reflect.DeepEqual(res, wantRes) {
+					t.Errorf("concurrent walk returned %+v, sequential walk %+v", res, wantRes)
+				}
+			})
+		}
+	}
+}
@@ -6,21 +6,93 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"sort"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/tinylib/msgp/msgp"
 	"golang.org/x/sys/unix"
 )
 
 type xlStorage struct {
 	diskPath string
+
+	// walkConcurrency is the number of ListDir and readMetadata calls
+	// WalkDir runs in parallel. Values below 2 walk synchronously.
+	walkConcurrency int
+
+	// stats records the time spent in every filesystem operation, if set.
+	stats *walkStats
+
+	// fs is the filesystem below diskPath, the real one if nil.
+	fs walkFS
+
+	// timeline records a span for every scanDir and filesystem
+	// operation, if set.
+	timeline *timeline
+}
+
+// filesystem returns the filesystem the storage reads from.
+func (s *xlStorage) filesystem() walkFS {
+	if s.fs != nil {
+		return s.fs
+	}
+	return osFS{stats: s.stats}
+}
+
+// metaCacheEntry is an object or a directory within an unknown bucket.
+type metaCacheEntry struct {
+	// name is the full name of the object including prefixes
+	name string
+	// Metadata. If none is present it is not an object but only a prefix.
+	// Entries without metadata will only be present in non-recursive scans.
+	metadata []byte
+	// kind tells where the metadata came from.
+	kind entryKind
+}
+
+// entryKind is the kind of entry WalkDir sends.
+type entryKind uint8
+
+const (
+	// kindPrefix is a directory without metadata.
+	kindPrefix entryKind = iota
+	// kindObject is an object with an xl.meta file.
+	kindObject
+	// kindDirObject is an object ending with a slash, stored in a
+	// __XLDIR__ directory.
+	kindDirObject
+	// kindLegacyObject is an object with a legacy xl.json file.
+	kindLegacyObject
+)
+
+// isDir returns if the entry is representing a prefix directory.
+func (e metaCacheEntry) isDir() bool {
+	return len(e.metadata) == 0 && strings.HasSuffix(e.name, SlashSeparator)
+}
+
+// isObject returns if the entry is representing an object.
+func (e metaCacheEntry) isObject() bool {
+	return len(e.metadata) > 0
 }
 
+// probeResult is the outcome of checking a directory entry for metadata.
+type probeResult int
+
+const (
+	// probeSkip entries are neither objects nor non-empty directories.
+	probeSkip probeResult = iota
+	// probeObject entries have metadata.
+	probeObject
+	// probeDir entries are non-empty directories without metadata.
+	probeDir
+)
+
 // WalkDirOptions provides options for WalkDir operations.
 type WalkDirOptions struct {
 	// Bucket to scanner
@@ -48,6 +120,9 @@ type WalkDirOptions struct {
 // compatible way for all operating systems. If volume is not found
 // an error is generated.
 func (s *xlStorage) getVolDir(volume string) (string, error) {
+	if volume == "" || volume == "." || volume == ".." {
+		return "", errVolumeNotFound
+	}
 	volumeDir := pathJoin(s.diskPath, volume)
 	return volumeDir, nil
 }
@@ -62,61 +137,134 @@ func Access(name string) error {
 // WalkDir will traverse a directory and return all entries found.
 // On success a sorted meta cache stream will be returned.
 // Metadata has data stripped, if any.
-func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
+// Every entry is passed to out in the order MinIO would send it.
+// Errors on single directories or objects do not stop the walk, they
+// are recorded in the result instead.
+func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions, out func(metaCacheEntry)) (res walkResult, err error) {
+	var errs walkErrors
+	defer func() {
+		res.Errors = errs.list()
+	}()
+	emit := func(meta metaCacheEntry) error {
+		res.count(meta.kind)
+		out(meta)
+		return nil
+	}
+	// The walk itself runs on the first track of the timeline.
+	tid := s.timeline.newTrack()
 
-	totalFiles := 0
 	// Verify if volume is valid and it exists.
 	volumeDir, err := s.getVolDir(opts.Bucket)
 	if err != nil {
-		log.Fatal(err)
+		return res, err
 	}
 
 	// Stat a volume entry.
-	if err = Access(volumeDir); err != nil {
-		log.Fatal(err)
-	}
-
-	/*
-		// Use a small block size to start sending quickly
-		w := newMetacacheWriter(wr, 16<<10)
-		w.reuseBlocks = true // We are not sharing results, so reuse buffers.
-		defer w.Close()
-		out, err := w.stream()
-		if err != nil {
-			return err
+	if err = s.filesystem().Access(volumeDir); err != nil {
+		if osIsNotExist(err) {
+			return res, errVolumeNotFound
+		} else if isSysErrIO(err) {
+			return res, errFaultyDisk
 		}
-		defer close(out)
-	*/
+		return res, err
+	}
 
 	// Fast exit track to check if we are listing an object with
 	// a trailing slash, this will avoid to list the object content.
 	if HasSuffix(opts.BaseDir, SlashSeparator) {
-		_, err := s.readMetadata(ctx, pathJoin(volumeDir,
+		metadata, err := s.readMetadata(ctx, tid, pathJoin(volumeDir,
 			opts.BaseDir[:len(opts.BaseDir)-1]+globalDirSuffix,
 			xlStorageFormatFile))
 		if err == nil {
 			// if baseDir is already a directory object, consider it
 			// as part of the list call, this is a AWS S3 specific
 			// behavior.
-			totalFiles += 1
-			/*
-				out <- metaCacheEntry{
-					name:     opts.BaseDir,
-					metadata: metadata,
-				}
-			*/
+			emit(metaCacheEntry{
+				name:     opts.BaseDir,
+				metadata: metadata,
+				kind:     kindDirObject,
+			})
 		} else {
-			st, sterr := os.Lstat(pathJoin(volumeDir, opts.BaseDir, xlStorageFormatFile))
+			st, sterr := s.filesystem().Lstat(pathJoin(volumeDir, opts.BaseDir, xlStorageFormatFile))
 			if sterr == nil && st.Mode().IsRegular() {
-				log.Fatal("File not found.")
+				return res, errFileNotFound
 			}
 		}
 	}
 
-	prefix := opts.FilterPrefix
-	var scanDir func(path string) error
+	// probeEntry checks whether an entry is an object by attempting to
+	// read its metadata. All objects will be returned as directories by
+	// ListDir, there has been no object check yet.
+	probeEntry := func(tid int64, current, entry string, isDirObj bool) (meta metaCacheEntry, result probeResult) {
+		var err error
+		meta.name = pathJoin(current, entry)
+		if isDirObj {
+			meta.name = meta.name[:len(meta.name)-1] + globalDirSuffixWithSlash
+		}
 
-	scanDir = func(current string) error {
+		meta.metadata, err = s.readMetadata(ctx, tid, pathJoin(volumeDir, meta.name, xlStorageFormatFile))
+		switch {
+		case err == nil:
+			// It was an object
+			meta.kind = kindObject
+			if isDirObj {
+				meta.name = strings.TrimSuffix(meta.name, globalDirSuffixWithSlash) + SlashSeparator
+				meta.kind = kindDirObject
+			}
+			return meta, probeObject
+		case osIsNotExist(err), isSysErrIsDir(err):
+			meta.metadata, err = s.readFileV1(tid, pathJoin(volumeDir, meta.name, xlStorageFormatFileV1))
+			if err == nil {
+				// It was an object
+				meta.kind = kindLegacyObject
+				return meta, probeObject
+			}
+			if !osIsNotExist(err) && !isSysErrIsDir(err) && !isSysErrNotDir(err) {
+				errs.record("ReadFile", pathJoin(meta.name, xlStorageFormatFileV1), err)
+			}
+
+			// NOT an object, append to stack (with slash)
+			// If dirObject, but no metadata (which is unexpected) we skip it.
+			if !isDirObj {
+				empty, err := s.isDirEmpty(tid, pathJoin(volumeDir, meta.name+SlashSeparator))
+				if err != nil && err != errFileNotFound {
+					errs.record("isDirEmpty", meta.name+SlashSeparator, err)
+				}
+				if !empty {
+					return meta, probeDir
+				}
+			}
+		case isSysErrNotDir(err):
+			// skip
+		case contextCanceled(ctx):
+			// skip
+		default:
+			// logger.LogIf(ctx, err)
+			errs.record("readMetadata", pathJoin(meta.name, xlStorageFormatFile), err)
+		}
+		return meta, probeSkip
+	}
+
+	// With concurrency enabled directories are scanned in their own
+	// goroutine as soon as they are found, as long as the pool allows
+	// another background scan. The output is collected in sort order
+	// when the directory is popped from the stack.
+	var pool *walkPool
+	if s.walkConcurrency > 1 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		pool = newWalkPool(s.walkConcurrency, s.timeline)
+		// Cancel first, so blocked scans return, then wait for all of them.
+		defer pool.wait()
+		defer cancel()
+	}
+
+	var scanDir func(tid int64, current string, send func(metaCacheEntry) error) error
+
+	// scanDir runs on track tid of the timeline, as do the directories
+	// below it that it scans itself.
+	scanDir = func(tid int64, current string, send func(metaCacheEntry) error) error {
+		defer s.timeline.span(tid, "scanDir", pathJoin(volumeDir, current), time.Now())
 		// Skip forward, if requested...
 		forward := ""
 		if len(opts.ForwardTo) > 0 && strings.HasPrefix(opts.ForwardTo, current) {
@@ -129,20 +277,31 @@ func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
 			return ctx.Err()
 		}
 
-		// s.walkMu.Lock()
-		entries, err := s.ListDir(ctx, opts.Bucket, current, -1)
-		// s.walkMu.Unlock()
+		// Only filter on the first level, deeper levels have already been filtered.
+		prefix := ""
+		if current == opts.BaseDir {
+			prefix = opts.FilterPrefix
+		}
+
+		var entries []string
+		var err error
+		pool.do(func() {
+			entries, err = s.ListDir(ctx, tid, opts.Bucket, current, -1)
+		})
 		if err != nil {
 			// Folder could have gone away in-between
-			// REMOVED
-
-			// ignore this!
-			/*
-				if opts.ReportNotFound && err == errFileNotFound && current == opts.BaseDir {
+			if err == errFileNotFound && current == opts.BaseDir {
+				if opts.ReportNotFound {
 					return errFileNotFound
 				}
-			*/
+				// A base dir that does not exist is an empty listing.
+				return nil
+			}
+			if contextCanceled(ctx) {
+				return ctx.Err()
+			}
 			// Forward some errors?
+			errs.record("ListDir", current, err)
 			return nil
 		}
 		if len(entries) == 0 {
@@ -182,44 +341,41 @@ func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
 			}
 			// If root was an object return it as such.
 			if HasSuffix(entry, xlStorageFormatFile) {
-				/*
-					var meta metaCacheEntry
-					s.walkReadMu.Lock()
-					meta.metadata, err = s.readMetadata(ctx, pathJoin(volumeDir, current, entry))
-					s.walkReadMu.Unlock()
-				*/
+				var meta metaCacheEntry
+				pool.do(func() {
+					meta.metadata, err = s.readMetadata(ctx, tid, pathJoin(volumeDir, current, entry))
+				})
 				if err != nil {
 					// logger.LogIf(ctx, err)
+					errs.record("readMetadata", pathJoin(current, entry), err)
 					continue
 				}
-				/*
-					meta.name = strings.TrimSuffix(entry, xlStorageFormatFile)
-					meta.name = strings.TrimSuffix(meta.name, SlashSeparator)
-					meta.name = pathJoin(current, meta.name)
-					meta.name = decodeDirObject(meta.name)
-				*/
-				totalFiles += 1
-				// out <- meta
-				return nil
+				meta.name = strings.TrimSuffix(entry, xlStorageFormatFile)
+				meta.name = strings.TrimSuffix(meta.name, SlashSeparator)
+				meta.name = pathJoin(current, meta.name)
+				meta.name = decodeDirObject(meta.name)
+				meta.kind = kindObject
+				if HasSuffix(meta.name, SlashSeparator) {
+					meta.kind = kindDirObject
+				}
+				return send(meta)
 			}
 			// Check legacy.
 			if HasSuffix(entry, xlStorageFormatFileV1) {
-				// var meta metaCacheEntry
-				// s.walkReadMu.Lock()
-				_, err = ReadFile(pathJoin(volumeDir, current, entry))
-				// s.walkReadMu.Unlock()
+				var meta metaCacheEntry
+				pool.do(func() {
+					meta.metadata, err = s.readFileV1(tid, pathJoin(volumeDir, current, entry))
+				})
 				if err != nil {
 					// logger.LogIf(ctx, err)
+					errs.record("ReadFile", pathJoin(current, entry), err)
 					continue
 				}
-				/*
-					meta.name = strings.TrimSuffix(entry, xlStorageFormatFileV1)
-					meta.name = strings.TrimSuffix(meta.name, SlashSeparator)
-					meta.name = pathJoin(current, meta.name)
-				*/
-				totalFiles += 1
-				//out <- meta
-				return nil
+				meta.name = strings.TrimSuffix(entry, xlStorageFormatFileV1)
+				meta.name = strings.TrimSuffix(meta.name, SlashSeparator)
+				meta.name = pathJoin(current, meta.name)
+				meta.kind = kindLegacyObject
+				return send(meta)
 			}
 			// Skip all other files.
 		}
@@ -227,7 +383,6 @@ func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
 		// Process in sort order.
 		sort.Strings(entries)
 		dirStack := make([]string, 0, 5)
-		prefix = "" // Remove prefix after first level as we have already filtered the list.
 		if len(forward) > 0 {
 			idx := sort.SearchStrings(entries, forward)
 			if idx > 0 {
@@ -235,80 +390,118 @@ func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
 			}
 		}
 
-		for _, entry := range entries {
+		// Read the metadata of the entries ahead of the loop below when
+		// running concurrently, in windows that start at the pool size and
+		// double. The first entries are sent quickly, e.g. when a small
+		// page only needs those, and large directories still keep the pool
+		// busy.
+		var probed []metaCacheEntry
+		var results []probeResult
+		probedTo, window := 0, 0
+		probeAhead := func(from int) {
+			if from < probedTo {
+				return
+			}
+			window = pool.nextWindow(window)
+			probedTo = from + window
+			if probedTo > len(entries) {
+				probedTo = len(entries)
+			}
+			pool.forEach(tid, "probe", pathJoin(volumeDir, current), probedTo-from, func(tid int64, i int) {
+				i += from
+				if entries[i] == "" || contextCanceled(ctx) {
+					return
+				}
+				_, isDirObj := dirObjects[entries[i]]
+				probed[i], results[i] = probeEntry(tid, current, entries[i], isDirObj)
+			})
+		}
+		if pool != nil {
+			probed = make([]metaCacheEntry, len(entries))
+			results = make([]probeResult, len(entries))
+		}
+		subScans := make(map[string]*walkStream)
+
+		// scanSubDir scans a directory popped from the stack, or collects
+		// the output of the goroutine that is already scanning it.
+		scanSubDir := func(dir string) error {
+			if st, ok := subScans[dir]; ok {
+				delete(subScans, dir)
+				return st.drain(send)
+			}
+			if err := scanDir(tid, dir, send); err != nil {
+				if contextCanceled(ctx) {
+					return err
+				}
+				// logger.LogIf(ctx, err)
+				errs.record("scanDir", dir, err)
+			}
+			return nil
+		}
+
+		for i, entry := range entries {
 			if entry == "" {
 				continue
 			}
 			if contextCanceled(ctx) {
 				return ctx.Err()
 			}
-			metaname := pathJoin(current, entry)
+			name := pathJoin(current, entry)
 
 			// If directory entry on stack before this, pop it now.
-			for len(dirStack) > 0 && dirStack[len(dirStack)-1] < metaname {
+			for len(dirStack) > 0 && dirStack[len(dirStack)-1] < name {
 				pop := dirStack[len(dirStack)-1]
-				totalFiles += 1
-				//out <- metaCacheEntry{name: pop}
+				if err := send(metaCacheEntry{name: pop}); err != nil {
+					return err
+				}
 				if opts.Recursive {
 					// Scan folder we found. Should be in correct sort order where we are.
 					forward = ""
 					if len(opts.ForwardTo) > 0 && strings.HasPrefix(opts.ForwardTo, pop) {
 						forward = strings.TrimPrefix(opts.ForwardTo, pop)
 					}
-					scanDir(pop)
+					if err := scanSubDir(pop); err != nil {
+						return err
+					}
 				}
 				dirStack = dirStack[:len(dirStack)-1]
 			}
 
-			// All objects will be returned as directories, there has been no object check yet.
-			// Check it by attempting to read metadata.
-			_, isDirObj := dirObjects[entry]
-			if isDirObj {
-				metaname = metaname[:len(metaname)-1] + globalDirSuffixWithSlash
+			var meta metaCacheEntry
+			var result probeResult
+			if pool != nil {
+				probeAhead(i)
+				meta, result = probed[i], results[i]
+			} else {
+				_, isDirObj := dirObjects[entry]
+				meta, result = probeEntry(tid, current, entry, isDirObj)
 			}
-
-			// s.walkReadMu.Lock()
-			_, err = s.readMetadata(ctx, pathJoin(volumeDir, metaname, xlStorageFormatFile))
-			// s.walkReadMu.Unlock()
-			switch {
-			case err == nil:
-				// It was an object
-				if isDirObj {
-					metaname = strings.TrimSuffix(metaname, globalDirSuffixWithSlash) + SlashSeparator
-				}
-				//out <- meta
-				totalFiles += 1
-			case osIsNotExist(err), isSysErrIsDir(err):
-				_, err = ReadFile(pathJoin(volumeDir, metaname, xlStorageFormatFileV1))
-				if err == nil {
-					// It was an object
-					// out <- meta
-					totalFiles += 1
-					continue
+			switch result {
+			case probeObject:
+				if err := send(meta); err != nil {
+					return err
 				}
-
-				// NOT an object, append to stack (with slash)
-				// If dirObject, but no metadata (which is unexpected) we skip it.
-				if !isDirObj {
-					if !isDirEmpty(pathJoin(volumeDir, metaname+SlashSeparator)) {
-						dirStack = append(dirStack, metaname+SlashSeparator)
+			case probeDir:
+				dirStack = append(dirStack, meta.name+SlashSeparator)
+				if pool != nil && opts.Recursive {
+					if st := pool.goScan(ctx, tid, meta.name+SlashSeparator, scanDir); st != nil {
+						subScans[meta.name+SlashSeparator] = st
 					}
 				}
-			case isSysErrNotDir(err):
-				// skip
-			default:
-				// skip
 			}
 		}
 
 		// If directory entry left on stack, pop it now.
 		for len(dirStack) > 0 {
 			pop := dirStack[len(dirStack)-1]
-			totalFiles += 1
-			// out <- metaCacheEntry{name: pop}
+			if err := send(metaCacheEntry{name: pop}); err != nil {
+				return err
+			}
 			if opts.Recursive {
 				// Scan folder we found. Should be in correct sort order where we are.
-				scanDir(pop)
+				if err := scanSubDir(pop); err != nil {
+					return err
+				}
 			}
 			dirStack = dirStack[:len(dirStack)-1]
 		}
@@ -316,13 +509,13 @@ func (s *xlStorage) WalkDir(ctx context.Context, opts WalkDirOptions) int {
 	}
 
 	// Stream output.
-	scanDir(opts.BaseDir)
-	return totalFiles
+	return res, scanDir(tid, opts.BaseDir, emit)
 }
 
 // ListDir - return all the entries at the given directory path.
 // If an entry is a directory it will be returned with a trailing SlashSeparator.
-func (s *xlStorage) ListDir(ctx context.Context, volume, dirPath string, count int) (entries []string, err error) {
+// The call is recorded on track tid of the timeline.
+func (s *xlStorage) ListDir(ctx context.Context, tid int64, volume, dirPath string, count int) (entries []string, err error) {
 	if contextCanceled(ctx) {
 		return nil, ctx.Err()
 	}
@@ -333,15 +526,16 @@ func (s *xlStorage) ListDir(ctx context.Context, volume, dirPath string, count i
 		return nil, err
 	}
 
+	defer s.stats.observe(opListDir, time.Now())
+	defer s.timeline.span(tid, opListDir.String(), pathJoin(volumeDir, dirPath), time.Now())
 	dirPathAbs := pathJoin(volumeDir, dirPath)
-	if count > 0 {
-		entries, err = readDirN(dirPathAbs, count)
-	} else {
-		entries, err = readDir(dirPathAbs)
+	if count <= 0 {
+		count = -1
 	}
+	entries, err = s.filesystem().ReadDir(dirPathAbs, count)
 	if err != nil {
 		if err == errFileNotFound {
-			if ierr := Access(volumeDir); ierr != nil {
+			if ierr := s.filesystem().Access(volumeDir); ierr != nil {
 				if osIsNotExist(ierr) {
 					return nil, errVolumeNotFound
 				} else if isSysErrIO(ierr) {
@@ -355,7 +549,7 @@ func (s *xlStorage) ListDir(ctx context.Context, volume, dirPath string, count i
 	return entries, nil
 }
 
-func (s *xlStorage) readMetadata(ctx context.Context, itemPath string) ([]byte, error) {
+func (s *xlStorage) readMetadata(ctx context.Context, tid int64, itemPath string) ([]byte, error) {
 	if contextCanceled(ctx) {
 		return nil, ctx.Err()
 	}
@@ -363,8 +557,10 @@ func (s *xlStorage) readMetadata(ctx context.Context, itemPath string) ([]byte,
 	if err := checkPathLength(itemPath); err != nil {
 		return nil, err
 	}
+	defer s.stats.observe(opReadMetadata, time.Now())
+	defer s.timeline.span(tid, opReadMetadata.String(), itemPath, time.Now())
 
-	f, err := os.OpenFile(itemPath, readMode, 0)
+	f, err := s.filesystem().Open(itemPath)
 	if err != nil {
 		return nil, err
 	}
@@ -422,61 +618,60 @@ func readXLMetaNoData(r io.Reader, size int64) ([]byte, error) {
 		}
 		return nil
 	}
-	return buf, nil
-
-	_, _, _, err = checkXL2V1(buf)
+	tmp, major, minor, err := checkXL2V1(buf)
 	if err != nil {
 		err = readMore(size)
 		return buf, err
 	}
-	return buf, nil
-	/*
-		switch major {
-		case 1:
-			switch minor {
-			case 0:
-				err = readMore(size)
-				return buf, err
-			case 1, 2:
-				sz, tmp, err := msgp.ReadBytesHeader(tmp)
-				if err != nil {
-					return nil, err
-				}
-				want := int64(sz) + int64(len(buf)-len(tmp))
-
-				// v1.1 does not have CRC.
-				if minor < 2 {
-					if err := readMore(want); err != nil {
-						return nil, err
-					}
-					return buf[:want], nil
-				}
-
-				// CRC is variable length, so we need to truncate exactly that.
-				wantMax := want + msgp.Uint32Size
-				if wantMax > size {
-					wantMax = size
-				}
-				if err := readMore(wantMax); err != nil {
-					return nil, err
-				}
+	switch major {
+	case 1:
+		switch minor {
+		case 0:
+			err = readMore(size)
+			return buf, err
+		case 1, 2, 3:
+			sz, tmp, err := msgp.ReadBytesHeader(tmp)
+			if err != nil {
+				return nil, err
+			}
+			metaStart := int64(len(buf) - len(tmp))
+			want := int64(sz) + metaStart
 
-				tmp = buf[want:]
-				_, after, err := msgp.ReadUint32Bytes(tmp)
-				if err != nil {
+			// v1.1 does not have CRC.
+			if minor < 2 {
+				if err := readMore(want); err != nil {
 					return nil, err
 				}
-				want += int64(len(tmp) - len(after))
+				return buf[:want], nil
+			}
 
-				return buf[:want], err
+			// CRC is variable length, so we need to truncate exactly that.
+			wantMax := want + msgp.Uint32Size
+			if wantMax > size {
+				wantMax = size
+			}
+			if err := readMore(wantMax); err != nil {
+				return nil, err
+			}
 
-			default:
-				return nil, errors.New("unknown minor metadata version")
+			tmp = buf[want:]
+			crc, after, err := msgp.ReadUint32Bytes(tmp)
+			if err != nil {
+				return nil, err
+			}
+			if got := uint32(xxhash.Sum64(buf[metaStart:want])); got != crc {
+				return nil, fmt.Errorf("xlMeta: version(%d.%d), CRC mismatch, want 0x%x, got 0x%x", major, minor, crc, got)
 			}
+			want += int64(len(tmp) - len(after))
+
+			return buf[:want], err
+
 		default:
-			return nil, errors.New("unknown major metadata version")
+			return nil, errors.New("unknown minor metadata version")
 		}
-	*/
+	default:
+		return nil, errors.New("unknown major metadata version")
+	}
 }
 
 // Return used metadata byte slices here.
@@ -488,34 +683,35 @@ func metaDataPoolGet() []byte {
 	return metaDataPool.Get().([]byte)[:0]
 }
 
-// isDirEmpty - returns whether given directory is empty or not.
-func isDirEmpty(dirname string) bool {
-	entries, err := readDirN(dirname, 1)
+// readFileV1 reads a legacy xl.json file.
+func (s *xlStorage) readFileV1(tid int64, name string) ([]byte, error) {
+	defer s.stats.observe(opReadFile, time.Now())
+	defer s.timeline.span(tid, opReadFile.String(), name, time.Now())
+	return s.filesystem().ReadFile(name)
+}
+
+// isDirEmpty - returns whether given directory is empty or not. It reads
+// from the storage's filesystem, records the time it took and returns
+// the error MinIO's isDirEmpty only logs. A directory that cannot be
+// read is not empty.
+func (s *xlStorage) isDirEmpty(tid int64, dirname string) (bool, error) {
+	defer s.stats.observe(opIsDirEmpty, time.Now())
+	defer s.timeline.span(tid, opIsDirEmpty.String(), dirname, time.Now())
+	entries, err := s.filesystem().ReadDir(dirname, 1)
 	if err != nil {
-		if err != errFileNotFound {
-			// logger.LogIf(GlobalContext, err)
-		}
-		return false
+		return false, err
 	}
-	return len(entries) == 0
+	return len(entries) == 0, nil
 }
 
-// Options for readDir function call
+// Options for readDirWithOpts function call
 type readDirOpts struct {
 	// The maximum number of entries to return
 	count int
 	// Follow directory symlink
 	followDirSymlink bool
-}
-
-// Return all the entries at the directory dirPath.
-func readDir(dirPath string) (entries []string, err error) {
-	return readDirWithOpts(dirPath, readDirOpts{count: -1})
-}
-
-// Return up to count entries at the directory dirPath.
-func readDirN(dirPath string, count int) (entries []string, err error) {
-	return readDirWithOpts(dirPath, readDirOpts{count: count})
+	// Record the time spent in Stat fallbacks, if set
+	stats *walkStats
 }
 
 // The buffer must be at least a block long.
@@ -588,7 +784,9 @@ func readDirWithOpts(dirPath string, opts readDirOpts) (entries []string, err er
 		// support Dirent.Type and have DT_UNKNOWN (0) there
 		// instead.
 		if typ == unexpectedFileMode || typ&os.ModeSymlink == os.ModeSymlink {
+			statStart := time.Now()
 			fi, err := os.Stat(pathJoin(dirPath, string(name)))
+			opts.stats.observe(opStat, statStart)
 			if err != nil {
 				// It got deleted in the meantime, not found
 				// or returns too many symlinks ignore this
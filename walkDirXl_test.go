@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWalkMissingBaseDir(t *testing.T) {
+	cfg := genConfig{Depth: 1, Fanout: 2, FilesPerDir: 3, DirObjectRatio: 1, Versions: 1, Seed: 5}
+	s, _ := newGenStorage(t, cfg, 0)
+	tests := []struct {
+		name    string
+		baseDir string
+		entries []string
+	}{
+		{"missing", "nothere/", nil},
+		// Only object00000__XLDIR__ exists, the directory object itself is
+		// listed.
+		{"directory object", "object00000/", []string{"object00000/"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, res := walkNames(t, s, WalkDirOptions{BaseDir: tc.baseDir})
+			if !reflect.DeepEqual(got, tc.entries) {
+				t.Errorf("got entries %v, want %v", got, tc.entries)
+			}
+			if len(res.Errors) > 0 {
+				t.Errorf("got errors %v, want none", res.Errors)
+			}
+			_, err := s.WalkDir(context.Background(), WalkDirOptions{Bucket: "bkt", BaseDir: tc.baseDir, Recursive: true, ReportNotFound: true},
+				func(metaCacheEntry) {})
+			if !errors.Is(err, errFileNotFound) {
+				t.Errorf("with ReportNotFound got error %v, want %v", err, errFileNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// walkResult is what WalkDir reports besides the entries it sends.
+type walkResult struct {
+	// Entries is the number of entries sent, the sum of all kinds below.
+	Entries int `json:"entries"`
+	// Objects with an xl.meta file.
+	Objects int `json:"objects"`
+	// DirObjects are objects ending with a slash, stored as __XLDIR__.
+	DirObjects int `json:"dirObjects"`
+	// LegacyObjects with an xl.json file.
+	LegacyObjects int `json:"legacyObjects"`
+	// Prefixes are directories without metadata. In a recursive walk
+	// they are sent right before their content.
+	Prefixes int `json:"prefixes"`
+	// Errors WalkDir ran into, recorded and skipped without stopping the walk.
+	Errors []walkError `json:"errors,omitempty"`
+}
+
+// count adds an entry of the given kind.
+func (r *walkResult) count(kind entryKind) {
+	r.Entries++
+	switch kind {
+	case kindObject:
+		r.Objects++
+	case kindDirObject:
+		r.DirObjects++
+	case kindLegacyObject:
+		r.LegacyObjects++
+	case kindPrefix:
+		r.Prefixes++
+	}
+}
+
+// subtract removes the entries counted in o, e.g. the entries a filter
+// hid from the listing.
+func (r *walkResult) subtract(o walkResult) {
+	r.Entries -= o.Entries
+	r.Objects -= o.Objects
+	r.DirObjects -= o.DirObjects
+	r.LegacyObjects -= o.LegacyObjects
+	r.Prefixes -= o.Prefixes
+}
+
+// RealObjects returns the number of entries that are objects, i.e. all
+// entries except prefixes. This is what 'mc ls --recursive' shows.
+func (r walkResult) RealObjects() int {
+	return r.Objects + r.DirObjects + r.LegacyObjects
+}
+
+// walkError is an error WalkDir skipped.
+type walkError struct {
+	// Op is the operation that failed, e.g. ListDir or readMetadata.
+	Op string
+	// Path the operation failed on.
+	Path string
+	Err  error
+}
+
+func (e walkError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e walkError) Unwrap() error {
+	return e.Err
+}
+
+func (e walkError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}{e.Op, e.Path, e.Err.Error()})
+}
+
+// walkErrors collects the errors of a walk. It is safe for concurrent use.
+type walkErrors struct {
+	mu   sync.Mutex
+	errs []walkError
+}
+
+func (w *walkErrors) record(op, path string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs = append(w.errs, walkError{Op: op, Path: path, Err: err})
+}
+
+func (w *walkErrors) list() []walkError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.errs
+}
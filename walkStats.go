@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// walkOp is a filesystem operation triggered by WalkDir.
+type walkOp int
+
+const (
+	// opListDir is ListDir, i.e. opening a directory and all getdents calls.
+	opListDir walkOp = iota
+	// opReadMetadata is opening and reading an xl.meta file.
+	opReadMetadata
+	// opReadFile is reading a legacy xl.json file.
+	opReadFile
+	// opIsDirEmpty is the check whether a directory without metadata is empty.
+	opIsDirEmpty
+	// opStat is the os.Stat fallback in readDirWithOpts for filesystems
+	// that do not fill in the type of a directory entry. It is part of
+	// the time spent in opListDir.
+	opStat
+
+	numWalkOps
+)
+
+var walkOpNames = [numWalkOps]string{
+	opListDir:      "ListDir",
+	opReadMetadata: "readMetadata",
+	opReadFile:     "ReadFile",
+	opIsDirEmpty:   "isDirEmpty",
+	opStat:         "Stat",
+}
+
+func (op walkOp) String() string {
+	if op < 0 || op >= numWalkOps {
+		return fmt.Sprintf("walkOp(%d)", int(op))
+	}
+	return walkOpNames[op]
+}
+
+// walkStats records the cumulative time, the number of calls and the
+// latency distribution of every walkOp. A nil *walkStats records
+// nothing. It is safe for concurrent use.
+type walkStats struct {
+	calls [numWalkOps]int64
+	nanos [numWalkOps]int64
+	hists [numWalkOps]latencyHistogram
+}
+
+// observe records a call of op that started at start and ends now.
+// It is meant to be deferred: defer s.stats.observe(opListDir, time.Now())
+func (s *walkStats) observe(op walkOp, start time.Time) {
+	if s == nil {
+		return
+	}
+	took := time.Since(start)
+	atomic.AddInt64(&s.calls[op], 1)
+	atomic.AddInt64(&s.nanos[op], int64(took))
+	s.hists[op].record(took)
+}
+
+// opTiming is the cumulative time spent in one walkOp.
+type opTiming struct {
+	Op      string  `json:"op"`
+	Calls   int64   `json:"calls"`
+	Seconds float64 `json:"seconds"`
+}
+
+// timings returns the recorded time of every walkOp.
+func (s *walkStats) timings() []opTiming {
+	if s == nil {
+		return nil
+	}
+	res := make([]opTiming, 0, numWalkOps)
+	for op := walkOp(0); op < numWalkOps; op++ {
+		res = append(res, opTiming{
+			Op:      op.String(),
+			Calls:   atomic.LoadInt64(&s.calls[op]),
+			Seconds: time.Duration(atomic.LoadInt64(&s.nanos[op])).Seconds(),
+		})
+	}
+	return res
+}
+
+// histograms returns the latency distribution of every walkOp.
+func (s *walkStats) histograms() []histogramSummary {
+	if s == nil {
+		return nil
+	}
+	res := make([]histogramSummary, 0, numWalkOps)
+	for op := walkOp(0); op < numWalkOps; op++ {
+		res = append(res, s.hists[op].summary(op.String()))
+	}
+	return res
+}
+
+// printTimings writes one comment line per walkOp, so the CSV output
+// of a walk stays parsable.
+func printTimings(w io.Writer, timings []opTiming) {
+	for _, t := range timings {
+		avg := 0.0
+		if t.Calls > 0 {
+			avg = t.Seconds / float64(t.Calls)
+		}
+		fmt.Fprintf(w, "# %s;%d;%f;%f\n", t.Op, t.Calls, t.Seconds, avg)
+	}
+}
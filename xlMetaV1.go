@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// XL meta version 1.0.0 and 1.0.1, the versions of xl.json.
+	xlMetaVersion100 = "1.0.0"
+	xlMetaVersion101 = "1.0.1"
+
+	// Format of xl.json.
+	xlMetaFormat = "xl"
+)
+
+// xlMetaV1Object is an object of format v1, stored as legacy xl.json by
+// old MinIO releases. Objects migrated to xl.meta keep it as a legacy
+// version.
+type xlMetaV1Object struct {
+	Version string `json:"version"` // Version of the current `xl.json`.
+	Format  string `json:"format"`  // Format of the current `xl.json`.
+	Stat    struct {
+		Size    int64     `json:"size"`    // Size of the object `xl.json`.
+		ModTime time.Time `json:"modTime"` // ModTime of the object `xl.json`.
+	} `json:"stat"`
+	Erasure struct {
+		Algorithm    string         `json:"algorithm"`
+		DataBlocks   int            `json:"data"`
+		ParityBlocks int            `json:"parity"`
+		BlockSize    int64          `json:"blockSize"`
+		Index        int            `json:"index"`
+		Distribution []int          `json:"distribution"`
+		Checksums    []checksumInfo `json:"checksum,omitempty"`
+	} `json:"erasure"`
+	Minio struct {
+		Release string `json:"release"`
+	} `json:"minio"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Parts     []objectPartInfo  `json:"parts,omitempty"`
+	VersionID string            `json:"versionId,omitempty"`
+	DataDir   string            `json:"dataDir,omitempty"`
+}
+
+// checksumInfo is the bitrot checksum of a part of a legacy object.
+type checksumInfo struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+}
+
+// bitrotAlgorithms are the names of the checksum algorithms of format
+// v1, by their number in the msgp encoding.
+var bitrotAlgorithms = map[uint]string{
+	1: "sha256",
+	2: "highwayhash256",
+	3: "highwayhash256S",
+	4: "blake2b",
+}
+
+// loadXLMetaV1 decodes a legacy xl.json file.
+func loadXLMetaV1(buf []byte) (*xlMetaV1Object, error) {
+	m := &xlMetaV1Object{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("%w: %v", errFileCorrupt, err)
+	}
+	if !m.valid() {
+		return nil, fmt.Errorf("%w: unknown xl.json version %q or format %q, or invalid erasure info", errFileCorrupt, m.Version, m.Format)
+	}
+	return m, nil
+}
+
+// valid returns if the version, format and erasure info are ones MinIO
+// accepts.
+func (m *xlMetaV1Object) valid() bool {
+	if m.Version != xlMetaVersion100 && m.Version != xlMetaVersion101 || m.Format != xlMetaFormat {
+		return false
+	}
+	return m.Erasure.DataBlocks >= m.Erasure.ParityBlocks && m.Erasure.DataBlocks != 0 && m.Erasure.ParityBlocks >= 0
+}
+
+// objectInfo returns the object info of the legacy object. Its only
+// version is the latest.
+func (m *xlMetaV1Object) objectInfo() objectInfo {
+	fi := objectInfo{
+		VersionID: m.VersionID,
+		Type:      LegacyType,
+		IsLatest:  true,
+		ModTime:   m.Stat.ModTime.UTC(),
+		Size:      m.Stat.Size,
+		DataDir:   m.DataDir,
+		Parts:     m.Parts,
+	}
+	if fi.VersionID == "" {
+		fi.VersionID = nullVersionID
+	}
+	if m.Erasure.Algorithm != "" {
+		fi.Erasure = &erasureInfo{
+			Algorithm:    m.Erasure.Algorithm,
+			Data:         m.Erasure.DataBlocks,
+			Parity:       m.Erasure.ParityBlocks,
+			BlockSize:    m.Erasure.BlockSize,
+			Index:        m.Erasure.Index,
+			Distribution: m.Erasure.Distribution,
+		}
+		if len(m.Erasure.Checksums) > 0 {
+			fi.Erasure.Checksum = m.Erasure.Checksums[0].Algorithm
+		}
+	}
+	// Meta holds the user metadata next to MinIO's internal metadata.
+	for k, v := range m.Meta {
+		if strings.HasPrefix(strings.ToLower(k), ReservedMetadataPrefixLower) {
+			continue
+		}
+		if fi.UserMetadata == nil {
+			fi.UserMetadata = make(map[string]string, len(m.Meta))
+		}
+		fi.UserMetadata[k] = v
+	}
+	return fi
+}
+
+// unmarshalMsg decodes a legacy object kept in an xl.meta. msgp uses
+// the Go field names as keys.
+func (z *xlMetaV1Object) unmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		field, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		if msgp.IsNil(b) {
+			if b, err = msgp.ReadNilBytes(b); err != nil {
+				return b, msgp.WrapError(err, string(field))
+			}
+			continue
+		}
+		switch string(field) {
+		case "Version":
+			z.Version, b, err = msgp.ReadStringBytes(b)
+		case "Format":
+			z.Format, b, err = msgp.ReadStringBytes(b)
+		case "Stat":
+			b, err = readMsgpFields(b, func(key string, b []byte) ([]byte, error) {
+				var err error
+				switch key {
+				case "Size":
+					z.Stat.Size, b, err = msgp.ReadInt64Bytes(b)
+				case "ModTime":
+					z.Stat.ModTime, b, err = msgp.ReadTimeBytes(b)
+				default:
+					b, err = msgp.Skip(b)
+				}
+				return b, err
+			})
+		case "Erasure":
+			b, err = z.unmarshalErasure(b)
+		case "Minio":
+			b, err = readMsgpFields(b, func(key string, b []byte) ([]byte, error) {
+				var err error
+				if key == "Release" {
+					z.Minio.Release, b, err = msgp.ReadStringBytes(b)
+				} else {
+					b, err = msgp.Skip(b)
+				}
+				return b, err
+			})
+		case "Meta":
+			var n uint32
+			n, b, err = msgp.ReadMapHeaderBytes(b)
+			z.Meta = make(map[string]string, n)
+			for j := uint32(0); j < n && err == nil; j++ {
+				var k, v string
+				if k, b, err = msgp.ReadStringBytes(b); err != nil {
+					break
+				}
+				v, b, err = msgp.ReadStringBytes(b)
+				z.Meta[k] = v
+			}
+		case "Parts":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			z.Parts = make([]objectPartInfo, n)
+			for j := range z.Parts {
+				if err != nil {
+					break
+				}
+				part := &z.Parts[j]
+				b, err = readMsgpFields(b, func(key string, b []byte) ([]byte, error) {
+					var err error
+					switch key {
+					case "ETag":
+						part.ETag, b, err = msgp.ReadStringBytes(b)
+					case "Number":
+						part.Number, b, err = msgp.ReadIntBytes(b)
+					case "Size":
+						part.Size, b, err = msgp.ReadInt64Bytes(b)
+					case "ActualSize":
+						part.ActualSize, b, err = msgp.ReadInt64Bytes(b)
+					default:
+						b, err = msgp.Skip(b)
+					}
+					return b, err
+				})
+			}
+		case "VersionID":
+			z.VersionID, b, err = msgp.ReadStringBytes(b)
+		case "DataDir":
+			z.DataDir, b, err = msgp.ReadStringBytes(b)
+		default:
+			b, err = msgp.Skip(b)
+		}
+		if err != nil {
+			return b, msgp.WrapError(err, string(field))
+		}
+	}
+	return b, nil
+}
+
+// unmarshalErasure decodes the msgp encoded erasure info of a legacy
+// object.
+func (z *xlMetaV1Object) unmarshalErasure(b []byte) ([]byte, error) {
+	e := &z.Erasure
+	return readMsgpFields(b, func(key string, b []byte) ([]byte, error) {
+		var err error
+		switch key {
+		case "Algorithm":
+			e.Algorithm, b, err = msgp.ReadStringBytes(b)
+		case "DataBlocks":
+			e.DataBlocks, b, err = msgp.ReadIntBytes(b)
+		case "ParityBlocks":
+			e.ParityBlocks, b, err = msgp.ReadIntBytes(b)
+		case "BlockSize":
+			e.BlockSize, b, err = msgp.ReadInt64Bytes(b)
+		case "Index":
+			e.Index, b, err = msgp.ReadIntBytes(b)
+		case "Distribution":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			e.Distribution = make([]int, n)
+			for j := range e.Distribution {
+				if err != nil {
+					break
+				}
+				e.Distribution[j], b, err = msgp.ReadIntBytes(b)
+			}
+		case "Checksums":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			e.Checksums = make([]checksumInfo, n)
+			for j := range e.Checksums {
+				if err != nil {
+					break
+				}
+				c := &e.Checksums[j]
+				b, err = readMsgpFields(b, func(key string, b []byte) ([]byte, error) {
+					var err error
+					switch key {
+					case "PartNumber":
+						var part int
+						part, b, err = msgp.ReadIntBytes(b)
+						c.Name = fmt.Sprintf("part.%d", part)
+					case "Algorithm":
+						var algo uint
+						algo, b, err = msgp.ReadUintBytes(b)
+						c.Algorithm = bitrotAlgorithms[algo]
+					default:
+						b, err = msgp.Skip(b)
+					}
+					return b, err
+				})
+			}
+		default:
+			b, err = msgp.Skip(b)
+		}
+		return b, err
+	})
+}
+
+// readMsgpFields reads a msgp map and calls field for every key. field
+// must consume the value.
+func readMsgpFields(b []byte, field func(key string, b []byte) ([]byte, error)) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var key []byte
+		if key, b, err = msgp.ReadMapKeyZC(b); err != nil {
+			return b, err
+		}
+		if b, err = field(string(key), b); err != nil {
+			return b, msgp.WrapError(err, string(key))
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyXLJSONRoundTrip(t *testing.T) {
+	modTime := time.Date(2019, 10, 12, 1, 39, 57, 123456789, time.UTC)
+	m, err := loadXLMetaV1(legacyXLJSON(1234, modTime))
+	if err != nil {
+		t.Fatalf("loadXLMetaV1: %v", err)
+	}
+	want := objectInfo{
+		VersionID: nullVersionID,
+		Type:      LegacyType,
+		IsLatest:  true,
+		ModTime:   modTime,
+		Size:      1234,
+		Erasure: &erasureInfo{
+			Algorithm:    "klauspost/reedsolomon/vandermonde",
+			Data:         1,
+			Parity:       0,
+			BlockSize:    blockSizeV2,
+			Index:        1,
+			Distribution: []int{1},
+			Checksum:     "highwayhash256S",
+		},
+		Parts:        []objectPartInfo{{Number: 1, Size: 1234, ActualSize: 1234}},
+		UserMetadata: map[string]string{"content-type": "application/octet-stream"},
+	}
+	if got := m.objectInfo(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got object info\n%+v\nwant\n%+v", got, want)
+	}
+	if m.Minio.Release != "RELEASE.2019-10-12T01-39-57Z" {
+		t.Errorf("got release %q", m.Minio.Release)
+	}
+}
+
+func TestLoadXLMetaV1Invalid(t *testing.T) {
+	valid := string(legacyXLJSON(10, time.Unix(1, 0)))
+	tests := []struct {
+		name string
+		buf  string
+	}{
+		{"not json", "XL2 "},
+		{"version", strings.Replace(valid, `"version":"1.0.1"`, `"version":"1.0.2"`, 1)},
+		{"format", strings.Replace(valid, `"format":"xl"`, `"format":"fs"`, 1)},
+		{"no data blocks", strings.Replace(valid, `"data":1`, `"data":0`, 1)},
+		{"more parity than data blocks", strings.Replace(valid, `"parity":0`, `"parity":2`, 1)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.buf == valid {
+				t.Fatal("test case does not change the xl.json")
+			}
+			if _, err := loadXLMetaV1([]byte(tc.buf)); !errors.Is(err, errFileCorrupt) {
+				t.Errorf("got error %v, want %v", err, errFileCorrupt)
+			}
+		})
+	}
+}
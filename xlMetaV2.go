@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// VersionType defines the type of journal type of the current entry.
+type VersionType uint8
+
+// List of different types of journal type
+const (
+	invalidVersionType VersionType = 0
+	ObjectType         VersionType = 1
+	DeleteType         VersionType = 2
+	LegacyType         VersionType = 3
+	lastVersionType    VersionType = 4
+)
+
+// String returns the name of the version type as shown in listings.
+func (t VersionType) String() string {
+	switch t {
+	case ObjectType:
+		return "object"
+	case DeleteType:
+		return "deleteMarker"
+	case LegacyType:
+		return "legacy"
+	}
+	return fmt.Sprintf("invalid(%d)", uint8(t))
+}
+
+// MarshalText encodes the version type by its name in JSON.
+func (t VersionType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ErasureAlgo defines common type of different erasure algorithms
+type ErasureAlgo uint8
+
+// List of currently supported erasure coding algorithms
+const (
+	invalidErasureAlgo ErasureAlgo = 0
+	ReedSolomon        ErasureAlgo = 1
+)
+
+func (e ErasureAlgo) String() string {
+	switch e {
+	case ReedSolomon:
+		return "reedsolomon"
+	}
+	return ""
+}
+
+// ChecksumAlgo defines common type of different checksum algorithms
+type ChecksumAlgo uint8
+
+// List of currently supported checksum algorithms
+const (
+	invalidChecksumAlgo ChecksumAlgo = 0
+	HighwayHash         ChecksumAlgo = 1
+)
+
+func (c ChecksumAlgo) String() string {
+	switch c {
+	case HighwayHash:
+		return "highwayhash"
+	}
+	return ""
+}
+
+const (
+	// Reserved metadata key prefix for MinIO internal use.
+	ReservedMetadataPrefixLower = "x-minio-internal-"
+
+	// Marks an object whose data is stored inline in xl.meta.
+	xlMetaInlineData = ReservedMetadataPrefixLower + "inline-data"
+
+	// Version of the inline data that follows the metadata.
+	xlMetaInlineDataVer = 1
+
+	// Version ID of unversioned objects.
+	nullVersionID = "null"
+)
+
+func init() {
+	binary.LittleEndian.PutUint16(xlVersionCurrent[0:2], xlVersionMajor)
+	binary.LittleEndian.PutUint16(xlVersionCurrent[2:4], xlVersionMinor)
+}
+
+// xlMetaV2DeleteMarker defines the data struct for the delete marker journal type
+type xlMetaV2DeleteMarker struct {
+	VersionID [16]byte
+	ModTime   int64
+	MetaSys   map[string][]byte
+}
+
+// xlMetaV2Object defines the data struct for object journal type
+type xlMetaV2Object struct {
+	VersionID          [16]byte
+	DataDir            [16]byte
+	ErasureAlgorithm   ErasureAlgo
+	ErasureM           int
+	ErasureN           int
+	ErasureBlockSize   int64
+	ErasureIndex       int
+	ErasureDist        []uint8
+	BitrotChecksumAlgo ChecksumAlgo
+	PartNumbers        []int
+	PartETags          []string
+	PartSizes          []int64
+	PartActualSizes    []int64
+	Size               int64
+	ModTime            int64
+	MetaSys            map[string][]byte
+	MetaUser           map[string]string
+}
+
+// xlMetaV2Version describes the journal entry, Type defines
+// the current journal entry type other types might be nil based
+// on what Type field carries, it is imperative for the caller
+// to verify which journal type first before accessing rest of the fields.
+type xlMetaV2Version struct {
+	Type         VersionType
+	ObjectV1     *xlMetaV1Object
+	ObjectV2     *xlMetaV2Object
+	DeleteMarker *xlMetaV2DeleteMarker
+}
+
+// appendMsg appends the msgp encoding of a delete marker.
+func (z *xlMetaV2DeleteMarker) appendMsg(o []byte) []byte {
+	n := uint32(2)
+	if len(z.MetaSys) > 0 {
+		n++
+	}
+	o = msgp.AppendMapHeader(o, n)
+	o = msgp.AppendString(o, "ID")
+	o = msgp.AppendBytes(o, z.VersionID[:])
+	o = msgp.AppendString(o, "MTime")
+	o = msgp.AppendInt64(o, z.ModTime)
+	if len(z.MetaSys) > 0 {
+		o = msgp.AppendString(o, "MetaSys")
+		o = appendMetaSys(o, z.MetaSys)
+	}
+	return o
+}
+
+// appendMsg appends the msgp encoding of an object version.
+func (z *xlMetaV2Object) appendMsg(o []byte) []byte {
+	n := uint32(15)
+	if len(z.MetaSys) > 0 {
+		n++
+	}
+	if len(z.MetaUser) > 0 {
+		n++
+	}
+	o = msgp.AppendMapHeader(o, n)
+	o = msgp.AppendString(o, "ID")
+	o = msgp.AppendBytes(o, z.VersionID[:])
+	o = msgp.AppendString(o, "DDir")
+	o = msgp.AppendBytes(o, z.DataDir[:])
+	o = msgp.AppendString(o, "EcAlgo")
+	o = msgp.AppendUint8(o, uint8(z.ErasureAlgorithm))
+	o = msgp.AppendString(o, "EcM")
+	o = msgp.AppendInt(o, z.ErasureM)
+	o = msgp.AppendString(o, "EcN")
+	o = msgp.AppendInt(o, z.ErasureN)
+	o = msgp.AppendString(o, "EcBSize")
+	o = msgp.AppendInt64(o, z.ErasureBlockSize)
+	o = msgp.AppendString(o, "EcIndex")
+	o = msgp.AppendInt(o, z.ErasureIndex)
+	o = msgp.AppendString(o, "EcDist")
+	o = msgp.AppendArrayHeader(o, uint32(len(z.ErasureDist)))
+	for _, d := range z.ErasureDist {
+		o = msgp.AppendUint8(o, d)
+	}
+	o = msgp.AppendString(o, "CSumAlgo")
+	o = msgp.AppendUint8(o, uint8(z.BitrotChecksumAlgo))
+	o = msgp.AppendString(o, "PartNums")
+	o = msgp.AppendArrayHeader(o, uint32(len(z.PartNumbers)))
+	for _, p := range z.PartNumbers {
+		o = msgp.AppendInt(o, p)
+	}
+	o = msgp.AppendString(o, "PartETags")
+	if z.PartETags == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.PartETags)))
+		for _, etag := range z.PartETags {
+			o = msgp.AppendString(o, etag)
+		}
+	}
+	o = msgp.AppendString(o, "PartSizes")
+	o = msgp.AppendArrayHeader(o, uint32(len(z.PartSizes)))
+	for _, sz := range z.PartSizes {
+		o = msgp.AppendInt64(o, sz)
+	}
+	o = msgp.AppendString(o, "PartASizes")
+	if z.PartActualSizes == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.PartActualSizes)))
+		for _, sz := range z.PartActualSizes {
+			o = msgp.AppendInt64(o, sz)
+		}
+	}
+	o = msgp.AppendString(o, "Size")
+	o = msgp.AppendInt64(o, z.Size)
+	o = msgp.AppendString(o, "MTime")
+	o = msgp.AppendInt64(o, z.ModTime)
+	if len(z.MetaSys) > 0 {
+		o = msgp.AppendString(o, "MetaSys")
+		o = appendMetaSys(o, z.MetaSys)
+	}
+	if len(z.MetaUser) > 0 {
+		o = msgp.AppendString(o, "MetaUsr")
+		o = msgp.AppendMapHeader(o, uint32(len(z.MetaUser)))
+		for _, k := range sortedKeys(z.MetaUser) {
+			o = msgp.AppendString(o, k)
+			o = msgp.AppendString(o, z.MetaUser[k])
+		}
+	}
+	return o
+}
+
+func appendMetaSys(o []byte, m map[string][]byte) []byte {
+	o = msgp.AppendMapHeader(o, uint32(len(m)))
+	for _, k := range sortedKeys(m) {
+		o = msgp.AppendString(o, k)
+		o = msgp.AppendBytes(o, m[k])
+	}
+	return o
+}
+
+// sortedKeys returns the keys of a map in sorted order, so the same
+// metadata is always encoded to the same bytes.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendMsg appends the msgp encoding of a journal entry.
+func (z *xlMetaV2Version) appendMsg(o []byte) []byte {
+	n := uint32(1)
+	if z.ObjectV2 != nil {
+		n++
+	}
+	if z.DeleteMarker != nil {
+		n++
+	}
+	o = msgp.AppendMapHeader(o, n)
+	o = msgp.AppendString(o, "Type")
+	o = msgp.AppendUint8(o, uint8(z.Type))
+	if z.ObjectV2 != nil {
+		o = msgp.AppendString(o, "V2Obj")
+		o = z.ObjectV2.appendMsg(o)
+	}
+	if z.DeleteMarker != nil {
+		o = msgp.AppendString(o, "DelObj")
+		o = z.DeleteMarker.appendMsg(o)
+	}
+	return o
+}
+
+// appendXLMetaV2 appends an xl.meta file in the current format (v1.2)
+// holding the given versions to dst. inline maps version IDs to the
+// data of objects stored inline, it may be nil.
+//
+// The layout is the 'XL2 ' header, the version, the versions as a msgp
+// bin, the xxhash of that bin as CRC and finally the inline data.
+func appendXLMetaV2(dst []byte, versions []xlMetaV2Version, inline map[string][]byte) []byte {
+	dst = append(dst, xlHeader[:]...)
+	dst = append(dst, xlVersionCurrent[:]...)
+	// Add "bin 32" type header to always have enough space.
+	// We will fill out the correct size when we know it.
+	dst = append(dst, 0xc6, 0, 0, 0, 0)
+	dataOffset := len(dst)
+
+	dst = msgp.AppendMapHeader(dst, 1)
+	dst = msgp.AppendString(dst, "Versions")
+	dst = msgp.AppendArrayHeader(dst, uint32(len(versions)))
+	for i := range versions {
+		dst = versions[i].appendMsg(dst)
+	}
+
+	// Update size...
+	binary.BigEndian.PutUint32(dst[dataOffset-4:dataOffset], uint32(len(dst)-dataOffset))
+
+	// Add CRC of metadata.
+	dst = msgp.AppendUint32(dst, uint32(xxhash.Sum64(dst[dataOffset:])))
+
+	if len(inline) == 0 {
+		return dst
+	}
+	dst = append(dst, xlMetaInlineDataVer)
+	dst = msgp.AppendMapHeader(dst, uint32(len(inline)))
+	for _, k := range sortedKeys(inline) {
+		dst = msgp.AppendString(dst, k)
+		dst = msgp.AppendBytes(dst, inline[k])
+	}
+	return dst
+}
+
+// newInlineObject returns the xl.meta of a single, unversioned object
+// with data stored inline, like MinIO writes it for small objects on a
+// single drive.
+func newInlineObject(data []byte, modTime time.Time, dataDir [16]byte) []byte {
+	versions := []xlMetaV2Version{{Type: ObjectType, ObjectV2: newInlineVersion(data, modTime, dataDir)}}
+	return appendXLMetaV2(nil, versions, map[string][]byte{nullVersionID: data})
+}
+
+// newInlineVersion returns an object version without version ID with
+// data stored inline.
+func newInlineVersion(data []byte, modTime time.Time, dataDir [16]byte) *xlMetaV2Object {
+	etag := md5.Sum(data)
+	return &xlMetaV2Object{
+		DataDir:            dataDir,
+		ErasureAlgorithm:   ReedSolomon,
+		ErasureM:           1,
+		ErasureN:           0,
+		ErasureBlockSize:   blockSizeV2,
+		ErasureIndex:       1,
+		ErasureDist:        []uint8{1},
+		BitrotChecksumAlgo: HighwayHash,
+		PartNumbers:        []int{1},
+		PartETags:          nil,
+		PartSizes:          []int64{int64(len(data))},
+		PartActualSizes:    []int64{int64(len(data))},
+		Size:               int64(len(data)),
+		ModTime:            modTime.UnixNano(),
+		MetaSys: map[string][]byte{
+			xlMetaInlineData: []byte("true"),
+		},
+		MetaUser: map[string]string{
+			"content-type": "application/octet-stream",
+			"etag":         hex.EncodeToString(etag[:]),
+		},
+	}
+}
+
+// blockSizeV2 is the erasure block size MinIO uses.
+const blockSizeV2 = 1 << 20
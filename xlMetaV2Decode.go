@@ -0,0 +1,479 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// xlMetaV2 is a decoded xl.meta file.
+type xlMetaV2 struct {
+	Major, Minor uint16
+	Versions     []xlMetaV2Version
+	// data maps version IDs to the data of objects stored inline. It is
+	// nil if the file has no inline data or it was not read.
+	data map[string][]byte
+}
+
+const (
+	// xlHeaderVersion and xlMetaVersion are the newest versions of the
+	// version headers and journal entries of a v1.3 file that are known.
+	xlHeaderVersion = 3
+	xlMetaVersion   = 3
+)
+
+// loadXLMetaV2 decodes an xl.meta file. buf may end after the metadata,
+// like readXLMetaNoData returns it, in which case there is no inline data.
+func loadXLMetaV2(buf []byte) (*xlMetaV2, error) {
+	payload, major, minor, err := checkXL2V1(buf)
+	if err != nil {
+		return nil, err
+	}
+	z := &xlMetaV2{Major: major, Minor: minor}
+	switch major {
+	case 1:
+		switch minor {
+		case 0:
+			_, err = z.unmarshalMsg(payload)
+			return z, err
+		case 1, 2, 3:
+			v, rest, err := msgp.ReadBytesZC(payload)
+			if err != nil {
+				return nil, err
+			}
+			if minor >= 2 {
+				var crc uint32
+				crc, rest, err = msgp.ReadUint32Bytes(rest)
+				if err != nil {
+					return nil, fmt.Errorf("xlMeta: reading CRC: %w", err)
+				}
+				if got := uint32(xxhash.Sum64(v)); got != crc {
+					return nil, fmt.Errorf("xlMeta: version(%d.%d), CRC mismatch, want 0x%x, got 0x%x", major, minor, crc, got)
+				}
+			}
+			if minor == 3 {
+				_, err = z.unmarshalIndexed(v)
+			} else {
+				_, err = z.unmarshalMsg(v)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(rest) > 0 {
+				z.data, err = decodeInlineData(rest)
+			}
+			return z, err
+		default:
+			return nil, errors.New("unknown minor metadata version")
+		}
+	default:
+		return nil, errors.New("unknown major metadata version")
+	}
+}
+
+// decodeInlineData decodes the inline data following the metadata.
+func decodeInlineData(b []byte) (map[string][]byte, error) {
+	if b[0] != xlMetaInlineDataVer {
+		return nil, fmt.Errorf("xlMeta: unknown inline data version %d", b[0])
+	}
+	sz, b, err := msgp.ReadMapHeaderBytes(b[1:])
+	if err != nil {
+		return nil, msgp.WrapError(err, "InlineData")
+	}
+	data := make(map[string][]byte, sz)
+	for i := uint32(0); i < sz; i++ {
+		var key string
+		var v []byte
+		key, b, err = msgp.ReadStringBytes(b)
+		if err != nil {
+			return nil, msgp.WrapError(err, "InlineData")
+		}
+		v, b, err = msgp.ReadBytesZC(b)
+		if err != nil {
+			return nil, msgp.WrapError(err, "InlineData", key)
+		}
+		data[key] = v
+	}
+	return data, nil
+}
+
+// unmarshalMsg decodes the msgp encoded list of versions.
+func (z *xlMetaV2) unmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		field, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		switch string(field) {
+		case "Versions":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			if err != nil {
+				return b, msgp.WrapError(err, "Versions")
+			}
+			z.Versions = make([]xlMetaV2Version, n)
+			for j := range z.Versions {
+				b, err = z.Versions[j].unmarshalMsg(b)
+				if err != nil {
+					return b, msgp.WrapError(err, "Versions", j)
+				}
+			}
+		default:
+			if b, err = msgp.Skip(b); err != nil {
+				return b, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// unmarshalIndexed decodes the versions of a v1.3 file. They are stored
+// after the header version, the meta version and their number, each as
+// a msgp bin holding the version header followed by a msgp bin holding
+// the journal entry. The headers only repeat what is in the journal
+// entries and are skipped.
+func (z *xlMetaV2) unmarshalIndexed(b []byte) ([]byte, error) {
+	hdrVer, b, err := msgp.ReadUintBytes(b)
+	if err != nil {
+		return b, msgp.WrapError(err, "HeaderVersion")
+	}
+	metaVer, b, err := msgp.ReadUintBytes(b)
+	if err != nil {
+		return b, msgp.WrapError(err, "MetaVersion")
+	}
+	if hdrVer > xlHeaderVersion {
+		return b, fmt.Errorf("xlMeta: unknown xl header version %d", hdrVer)
+	}
+	if metaVer > xlMetaVersion {
+		return b, fmt.Errorf("xlMeta: unknown xl meta version %d", metaVer)
+	}
+	n, b, err := msgp.ReadIntBytes(b)
+	if err != nil {
+		return b, msgp.WrapError(err, "Versions")
+	}
+	// Every version takes at least two bytes, the headers of both bins.
+	if n < 0 || n > len(b)/2 {
+		return b, fmt.Errorf("xlMeta: invalid number of versions %d", n)
+	}
+	z.Versions = make([]xlMetaV2Version, n)
+	for j := range z.Versions {
+		if _, b, err = msgp.ReadBytesZC(b); err != nil {
+			return b, msgp.WrapError(err, "Versions", j, "Header")
+		}
+		var meta []byte
+		if meta, b, err = msgp.ReadBytesZC(b); err != nil {
+			return b, msgp.WrapError(err, "Versions", j, "Meta")
+		}
+		if _, err = z.Versions[j].unmarshalMsg(meta); err != nil {
+			return b, msgp.WrapError(err, "Versions", j)
+		}
+	}
+	return b, nil
+}
+
+// unmarshalMsg decodes a journal entry.
+func (z *xlMetaV2Version) unmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		field, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		if msgp.IsNil(b) {
+			if b, err = msgp.ReadNilBytes(b); err != nil {
+				return b, msgp.WrapError(err, string(field))
+			}
+			continue
+		}
+		switch string(field) {
+		case "Type":
+			var t uint8
+			t, b, err = msgp.ReadUint8Bytes(b)
+			z.Type = VersionType(t)
+		case "V1Obj":
+			z.ObjectV1 = &xlMetaV1Object{}
+			b, err = z.ObjectV1.unmarshalMsg(b)
+		case "V2Obj":
+			z.ObjectV2 = &xlMetaV2Object{}
+			b, err = z.ObjectV2.unmarshalMsg(b)
+		case "DelObj":
+			z.DeleteMarker = &xlMetaV2DeleteMarker{}
+			b, err = z.DeleteMarker.unmarshalMsg(b)
+		default:
+			b, err = msgp.Skip(b)
+		}
+		if err != nil {
+			return b, msgp.WrapError(err, string(field))
+		}
+	}
+	return b, z.valid()
+}
+
+// valid returns an error if the journal entry does not carry the
+// object its type announces.
+func (z *xlMetaV2Version) valid() error {
+	switch z.Type {
+	case ObjectType:
+		if z.ObjectV2 != nil {
+			return nil
+		}
+	case DeleteType:
+		if z.DeleteMarker != nil {
+			return nil
+		}
+	case LegacyType:
+		if z.ObjectV1 != nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("xlMeta: invalid version type %d", z.Type)
+	}
+	return fmt.Errorf("xlMeta: version of type %v without its object", z.Type)
+}
+
+// unmarshalMsg decodes a delete marker.
+func (z *xlMetaV2DeleteMarker) unmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		field, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		switch string(field) {
+		case "ID":
+			b, err = msgp.ReadExactBytes(b, z.VersionID[:])
+		case "MTime":
+			z.ModTime, b, err = msgp.ReadInt64Bytes(b)
+		case "MetaSys":
+			z.MetaSys, b, err = readMetaSys(b)
+		default:
+			b, err = msgp.Skip(b)
+		}
+		if err != nil {
+			return b, msgp.WrapError(err, string(field))
+		}
+	}
+	return b, nil
+}
+
+// unmarshalMsg decodes an object version.
+func (z *xlMetaV2Object) unmarshalMsg(b []byte) ([]byte, error) {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < sz; i++ {
+		var field []byte
+		field, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		if msgp.IsNil(b) {
+			if b, err = msgp.ReadNilBytes(b); err != nil {
+				return b, msgp.WrapError(err, string(field))
+			}
+			continue
+		}
+		switch string(field) {
+		case "ID":
+			b, err = msgp.ReadExactBytes(b, z.VersionID[:])
+		case "DDir":
+			b, err = msgp.ReadExactBytes(b, z.DataDir[:])
+		case "EcAlgo":
+			var a uint8
+			a, b, err = msgp.ReadUint8Bytes(b)
+			z.ErasureAlgorithm = ErasureAlgo(a)
+		case "EcM":
+			z.ErasureM, b, err = msgp.ReadIntBytes(b)
+		case "EcN":
+			z.ErasureN, b, err = msgp.ReadIntBytes(b)
+		case "EcBSize":
+			z.ErasureBlockSize, b, err = msgp.ReadInt64Bytes(b)
+		case "EcIndex":
+			z.ErasureIndex, b, err = msgp.ReadIntBytes(b)
+		case "EcDist":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			z.ErasureDist = make([]uint8, n)
+			for j := range z.ErasureDist {
+				if err != nil {
+					break
+				}
+				z.ErasureDist[j], b, err = msgp.ReadUint8Bytes(b)
+			}
+		case "CSumAlgo":
+			var a uint8
+			a, b, err = msgp.ReadUint8Bytes(b)
+			z.BitrotChecksumAlgo = ChecksumAlgo(a)
+		case "PartNums":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			z.PartNumbers = make([]int, n)
+			for j := range z.PartNumbers {
+				if err != nil {
+					break
+				}
+				z.PartNumbers[j], b, err = msgp.ReadIntBytes(b)
+			}
+		case "PartETags":
+			var n uint32
+			n, b, err = msgp.ReadArrayHeaderBytes(b)
+			z.PartETags = make([]string, n)
+			for j := range z.PartETags {
+				if err != nil {
+					break
+				}
+				z.PartETags[j], b, err = msgp.ReadStringBytes(b)
+			}
+		case "PartSizes":
+			z.PartSizes, b, err = readInt64s(b)
+		case "PartASizes":
+			z.PartActualSizes, b, err = readInt64s(b)
+		case "Size":
+			z.Size, b, err = msgp.ReadInt64Bytes(b)
+		case "MTime":
+			z.ModTime, b, err = msgp.ReadInt64Bytes(b)
+		case "MetaSys":
+			z.MetaSys, b, err = readMetaSys(b)
+		case "MetaUsr":
+			var n uint32
+			n, b, err = msgp.ReadMapHeaderBytes(b)
+			z.MetaUser = make(map[string]string, n)
+			for j := uint32(0); j < n && err == nil; j++ {
+				var k, v string
+				if k, b, err = msgp.ReadStringBytes(b); err != nil {
+					break
+				}
+				v, b, err = msgp.ReadStringBytes(b)
+				z.MetaUser[k] = v
+			}
+		default:
+			b, err = msgp.Skip(b)
+		}
+		if err != nil {
+			return b, msgp.WrapError(err, string(field))
+		}
+	}
+	return b, nil
+}
+
+func readMetaSys(b []byte) (map[string][]byte, []byte, error) {
+	n, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	m := make(map[string][]byte, n)
+	for i := uint32(0); i < n; i++ {
+		var k string
+		var v []byte
+		if k, b, err = msgp.ReadStringBytes(b); err != nil {
+			return nil, b, err
+		}
+		if v, b, err = msgp.ReadBytesBytes(b, nil); err != nil {
+			return nil, b, msgp.WrapError(err, k)
+		}
+		m[k] = v
+	}
+	return m, b, nil
+}
+
+func readInt64s(b []byte) ([]int64, []byte, error) {
+	n, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	s := make([]int64, n)
+	for i := range s {
+		if s[i], b, err = msgp.ReadInt64Bytes(b); err != nil {
+			return nil, b, msgp.WrapError(err, i)
+		}
+	}
+	return s, b, nil
+}
+
+// inlineData returns if the data of an object version is stored inline.
+func (z *xlMetaV2Object) inlineData() bool {
+	return string(z.MetaSys[xlMetaInlineData]) == "true"
+}
+
+// objectInfo returns the object info of a journal entry.
+func (z *xlMetaV2Version) objectInfo() objectInfo {
+	var fi objectInfo
+	fi.Type = z.Type
+	switch z.Type {
+	case ObjectType:
+		obj := z.ObjectV2
+		fi.VersionID = formatVersionID(obj.VersionID)
+		fi.ModTime = time.Unix(0, obj.ModTime).UTC()
+		fi.Size = obj.Size
+		if obj.DataDir != [16]byte{} {
+			fi.DataDir = formatUUID(obj.DataDir)
+		}
+		fi.Erasure = &erasureInfo{
+			Algorithm: obj.ErasureAlgorithm.String(),
+			Data:      obj.ErasureM,
+			Parity:    obj.ErasureN,
+			BlockSize: obj.ErasureBlockSize,
+			Index:     obj.ErasureIndex,
+			Checksum:  obj.BitrotChecksumAlgo.String(),
+		}
+		fi.Erasure.Distribution = make([]int, len(obj.ErasureDist))
+		for i, d := range obj.ErasureDist {
+			fi.Erasure.Distribution[i] = int(d)
+		}
+		fi.Parts = make([]objectPartInfo, len(obj.PartNumbers))
+		for i := range fi.Parts {
+			fi.Parts[i].Number = obj.PartNumbers[i]
+			if i < len(obj.PartETags) {
+				fi.Parts[i].ETag = obj.PartETags[i]
+			}
+			if i < len(obj.PartSizes) {
+				fi.Parts[i].Size = obj.PartSizes[i]
+			}
+			if i < len(obj.PartActualSizes) {
+				fi.Parts[i].ActualSize = obj.PartActualSizes[i]
+			}
+		}
+		fi.UserMetadata = obj.MetaUser
+		fi.Inline = obj.inlineData()
+	case DeleteType:
+		fi.VersionID = formatVersionID(z.DeleteMarker.VersionID)
+		fi.ModTime = time.Unix(0, z.DeleteMarker.ModTime).UTC()
+	case LegacyType:
+		fi = z.ObjectV1.objectInfo()
+	}
+	return fi
+}
+
+// listVersions returns all versions, the latest first, like MinIO lists
+// them.
+func (z *xlMetaV2) listVersions() []objectInfo {
+	versions := make([]objectInfo, len(z.Versions))
+	for i := range z.Versions {
+		versions[i] = z.Versions[i].objectInfo()
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].ModTime.After(versions[j].ModTime)
+	})
+	if len(versions) > 0 {
+		versions[0].IsLatest = true
+	}
+	return versions
+}
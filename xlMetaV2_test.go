@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// appendTestXLMeta encodes an xl.meta of version 1.minor. appendXLMetaV2
+// only writes the current version, v1.2.
+func appendTestXLMeta(minor uint16, versions []xlMetaV2Version, inline map[string][]byte) []byte {
+	var meta []byte
+	if minor == 3 {
+		meta = msgp.AppendUint(meta, xlHeaderVersion)
+		meta = msgp.AppendUint(meta, xlMetaVersion)
+		meta = msgp.AppendInt(meta, len(versions))
+		for i := range versions {
+			// The version header is skipped when decoding, any bin will do.
+			meta = msgp.AppendBytes(meta, []byte("header"))
+			meta = msgp.AppendBytes(meta, versions[i].appendMsg(nil))
+		}
+	} else {
+		meta = msgp.AppendMapHeader(meta, 1)
+		meta = msgp.AppendString(meta, "Versions")
+		meta = msgp.AppendArrayHeader(meta, uint32(len(versions)))
+		for i := range versions {
+			meta = versions[i].appendMsg(meta)
+		}
+	}
+	buf := append([]byte{}, xlHeader[:]...)
+	buf = append(buf, 1, 0, byte(minor), 0)
+	buf = msgp.AppendBytes(buf, meta)
+	if minor >= 2 {
+		buf = msgp.AppendUint32(buf, uint32(xxhash.Sum64(meta)))
+	}
+	if len(inline) > 0 {
+		buf = append(buf, xlMetaInlineDataVer)
+		buf = msgp.AppendMapHeader(buf, uint32(len(inline)))
+		for _, k := range sortedKeys(inline) {
+			buf = msgp.AppendString(buf, k)
+			buf = msgp.AppendBytes(buf, inline[k])
+		}
+	}
+	return buf
+}
+
+// testVersions returns n object versions with inline data of size bytes
+// each, followed by a delete marker if deleted is set.
+func testVersions(n, size int, deleted bool) ([]xlMetaV2Version, map[string][]byte) {
+	var versions []xlMetaV2Version
+	inline := make(map[string][]byte)
+	t := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i%26)}, size)
+		obj := newInlineVersion(data, t, [16]byte{1, byte(i)})
+		if n > 1 || deleted {
+			obj.VersionID = [16]byte{2, byte(i), byte(i >> 8)}
+		}
+		versions = append(versions, xlMetaV2Version{Type: ObjectType, ObjectV2: obj})
+		inline[formatVersionID(obj.VersionID)] = data
+		t = t.Add(time.Second)
+	}
+	if deleted {
+		versions = append(versions, xlMetaV2Version{Type: DeleteType, DeleteMarker: &xlMetaV2DeleteMarker{
+			VersionID: [16]byte{3},
+			ModTime:   t.UnixNano(),
+		}})
+	}
+	return versions, inline
+}
+
+func TestXLMetaRoundTrip(t *testing.T) {
+	small, smallData := testVersions(1, 10, false)
+	large, largeData := testVersions(1, 3*metaDataReadDefault, false)
+	many, manyData := testVersions(100, 100, true)
+	deleted, _ := testVersions(1, 0, true)
+
+	tests := []struct {
+		name     string
+		buf      []byte
+		versions []xlMetaV2Version
+		inline   map[string][]byte
+	}{
+		{"v1.2 inline", appendXLMetaV2(nil, small, smallData), small, smallData},
+		{"v1.2 inline larger than first read", appendXLMetaV2(nil, large, largeData), large, largeData},
+		{"v1.2 metadata larger than first read", appendXLMetaV2(nil, many, manyData), many, manyData},
+		{"v1.2 without inline data", appendXLMetaV2(nil, deleted, nil), deleted, nil},
+		{"v1.2 new object", newInlineObject([]byte("hello"), time.Unix(1, 0), [16]byte{9}),
+			[]xlMetaV2Version{{Type: ObjectType, ObjectV2: newInlineVersion([]byte("hello"), time.Unix(1, 0), [16]byte{9})}},
+			map[string][]byte{nullVersionID: []byte("hello")}},
+		{"v1.1", appendTestXLMeta(1, many, manyData), many, manyData},
+		{"v1.3", appendTestXLMeta(3, many, manyData), many, manyData},
+		{"v1.3 inline larger than first read", appendTestXLMeta(3, large, largeData), large, largeData},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			want := (&xlMetaV2{Versions: tc.versions}).listVersions()
+
+			full, err := loadXLMetaV2(tc.buf)
+			if err != nil {
+				t.Fatalf("loadXLMetaV2: %v", err)
+			}
+			if got := full.listVersions(); !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded versions\n%+v\nwant\n%+v", got, want)
+			}
+			if len(full.data) != len(tc.inline) {
+				t.Errorf("decoded inline data of %d versions, want %d", len(full.data), len(tc.inline))
+			}
+			for k, v := range tc.inline {
+				if !bytes.Equal(full.data[k], v) {
+					t.Errorf("inline data of %s differs", k)
+				}
+			}
+
+			meta, err := readXLMetaNoData(bytes.NewReader(tc.buf), int64(len(tc.buf)))
+			if err != nil {
+				t.Fatalf("readXLMetaNoData: %v", err)
+			}
+			if !bytes.HasPrefix(tc.buf, meta) {
+				t.Fatalf("readXLMetaNoData returned %d bytes that are not a prefix of the file", len(meta))
+			}
+			if len(tc.inline) > 0 && len(meta) == len(tc.buf) {
+				t.Errorf("readXLMetaNoData read the inline data")
+			}
+			noData, err := loadXLMetaV2(meta)
+			if err != nil {
+				t.Fatalf("loadXLMetaV2 without data: %v", err)
+			}
+			if got := noData.listVersions(); !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded versions without data\n%+v\nwant\n%+v", got, want)
+			}
+			if noData.data != nil {
+				t.Errorf("decoded inline data that was not read")
+			}
+		})
+	}
+}
+
+func TestXLMetaCRCMismatch(t *testing.T) {
+	versions, inline := testVersions(3, 10, true)
+	for _, minor := range []uint16{2, 3} {
+		t.Run(fmt.Sprintf("v1.%d", minor), func(t *testing.T) {
+			buf := appendTestXLMeta(minor, versions, inline)
+			// Flip a byte within the metadata, after the header, the version
+			// and the bin header.
+			buf[len(xlHeader)+4+5+10] ^= 0xff
+
+			if _, err := readXLMetaNoData(bytes.NewReader(buf), int64(len(buf))); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+				t.Errorf("readXLMetaNoData: got error %v, want a CRC mismatch", err)
+			}
+			if _, err := loadXLMetaV2(buf); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+				t.Errorf("loadXLMetaV2: got error %v, want a CRC mismatch", err)
+			}
+		})
+	}
+}